@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// budgetOptions are the monthly budget flags shared by the default command and report.
+type budgetOptions struct {
+	USD     stringList
+	RepoPct float64
+	Webhook string
+}
+
+// budgetFlags registers --budget-usd, --budget-repo-pct and --budget-webhook.
+func budgetFlags(fs *flag.FlagSet, b *budgetOptions) {
+	fs.Var(&b.USD, "budget-usd", "Monthly budget in USD for every priced model, or \"Name:USD\" for one --pricing entry (repeatable); exit 6 if a projected monthly cost exceeds it")
+	fs.Float64Var(&b.RepoPct, "budget-repo-pct", 0, "Flag repositories whose projected monthly cost exceeds this percentage of the budget, e.g. 20 (0 disables)")
+	fs.StringVar(&b.Webhook, "budget-webhook", "", "POST a JSON alert to this URL when a budget is exceeded or repositories are flagged")
+}
+
+// budgetAlert is the JSON payload POSTed to --budget-webhook. Text is a one-line summary, the
+// field Slack-compatible incoming webhooks display.
+type budgetAlert struct {
+	Text        string                  `json:"text"`
+	Title       string                  `json:"title"`
+	Window      string                  `json:"window"`
+	Exceeded    bool                    `json:"exceeded"`
+	Budgets     []estimator.BudgetCheck `json:"budgets"`
+	GeneratedAt time.Time               `json:"generatedAt"`
+}
+
+// parseBudgets validates the budget flags against the prices that will be checked, so a typo
+// fails before a crawl rather than after it; invalid values exit with status 2. It returns nil
+// when no budget is set.
+func parseBudgets(b budgetOptions, pricing []estimator.Price) []estimator.Budget {
+	if len(b.USD) == 0 {
+		if b.RepoPct != 0 || b.Webhook != "" {
+			slog.Error("--budget-repo-pct and --budget-webhook require --budget-usd")
+			os.Exit(exitUsage)
+		}
+		return nil
+	}
+	if b.RepoPct < 0 || b.RepoPct > 100 {
+		slog.Error("invalid --budget-repo-pct, expected a percentage in [0, 100]", "value", b.RepoPct)
+		os.Exit(exitUsage)
+	}
+	if b.Webhook != "" {
+		if u, err := url.Parse(b.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			slog.Error("invalid --budget-webhook, expected an http(s) URL")
+			os.Exit(exitUsage)
+		}
+	}
+	var budgets []estimator.Budget
+	for _, v := range splitList(b.USD) {
+		bud, err := estimator.ParseBudget(v)
+		if err != nil {
+			slog.Error("invalid --budget-usd", "value", v, "err", err)
+			os.Exit(exitUsage)
+		}
+		budgets = append(budgets, bud)
+	}
+	if _, err := (&estimator.Result{Pricing: pricing}).CheckBudgets(budgets, 0); err != nil {
+		slog.Error("invalid --budget-usd", "err", err)
+		os.Exit(exitUsage)
+	}
+	return budgets
+}
+
+// checkBudgets compares the analysis with budgets; nil budgets yield no checks.
+func checkBudgets(a *estimator.Analysis, budgets []estimator.Budget, repoPct float64) []estimator.BudgetCheck {
+	if len(budgets) == 0 {
+		return nil
+	}
+	checks, err := a.CheckBudgets(budgets, repoPct)
+	if err != nil {
+		slog.Error("invalid --budget-usd", "err", err)
+		os.Exit(exitUsage)
+	}
+	return checks
+}
+
+// printBudgets writes the budget lines of the run summary; multiOrg qualifies repository names
+// with their org, as the report does.
+func printBudgets(w io.Writer, checks []estimator.BudgetCheck, multiOrg bool) {
+	for _, c := range checks {
+		status := "within budget"
+		if c.Exceeded {
+			status = "EXCEEDED"
+		}
+		fmt.Fprintf(w, " - Budget (%s): $%.2f/month projected of $%.2f (%.1f%%) %s\n", c.Model, c.MonthlyUSD, c.BudgetUSD, c.UsedPct, status)
+		for _, r := range c.Repos {
+			fmt.Fprintf(w, "   - %s: $%.2f/month (%.1f%% of budget)\n", repoBudgetName(r, multiOrg), r.MonthlyUSD, r.BudgetPct)
+		}
+	}
+}
+
+// repoBudgetName names a flagged repository in the summary, the webhook alert and the report:
+// org/name when the analysis covers several orgs, the bare name otherwise.
+func repoBudgetName(r estimator.RepoBudget, multiOrg bool) string {
+	if !multiOrg || r.Org == "" {
+		return r.Repo
+	}
+	return r.Org + "/" + r.Repo
+}
+
+// newBudgetAlert builds the webhook payload, or returns nil when there is nothing to report.
+func newBudgetAlert(a *estimator.Analysis, checks []estimator.BudgetCheck, repoPct float64) *budgetAlert {
+	alert := &budgetAlert{Title: a.Title, Window: a.Window, Budgets: checks, GeneratedAt: time.Now().UTC()}
+	var exceeded, flagged []string
+	seen := map[string]bool{}
+	multiOrg := len(a.OrgTotals) > 0
+	for _, c := range checks {
+		if c.Exceeded {
+			alert.Exceeded = true
+			exceeded = append(exceeded, fmt.Sprintf("%s $%.2f/month vs $%.2f (%.0f%%)", c.Model, c.MonthlyUSD, c.BudgetUSD, c.UsedPct))
+		}
+		for _, r := range c.Repos {
+			if name := repoBudgetName(r, multiOrg); !seen[name] {
+				seen[name] = true
+				flagged = append(flagged, name)
+			}
+		}
+	}
+	if !alert.Exceeded && len(flagged) == 0 {
+		return nil
+	}
+	var parts []string
+	if alert.Exceeded {
+		parts = append(parts, "exceeded by "+strings.Join(exceeded, "; "))
+	}
+	if len(flagged) > 0 {
+		parts = append(parts, fmt.Sprintf("repositories above %g%% of the budget: %s", repoPct, strings.Join(flagged, ", ")))
+	}
+	alert.Text = fmt.Sprintf("AI review budget for %s (%s): %s", a.Title, a.Window, strings.Join(parts, "; "))
+	return alert
+}
+
+// postBudgetAlert sends the alert to --budget-webhook when it is set and there is something to
+// report; a failed delivery exits with status 1.
+func postBudgetAlert(b budgetOptions, a *estimator.Analysis, checks []estimator.BudgetCheck) {
+	if b.Webhook == "" {
+		return
+	}
+	alert := newBudgetAlert(a, checks, b.RepoPct)
+	if alert == nil {
+		return
+	}
+	if err := sendBudgetAlert(&http.Client{Timeout: 30 * time.Second}, b.Webhook, alert); err != nil {
+		slog.Error("posting budget alert", "err", err)
+		os.Exit(exitError)
+	}
+	fmt.Println("Budget alert posted to --budget-webhook")
+}
+
+// sendBudgetAlert POSTs alert as JSON to webhook. Errors never include the URL, since webhook
+// URLs often embed a secret.
+func sendBudgetAlert(client *http.Client, webhook string, alert *budgetAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid --budget-webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pr-agent-cost-estimator")
+	resp, err := client.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook rejected the alert with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// exceededBudget returns the first check whose projected cost is over its budget, or nil.
+func exceededBudget(checks []estimator.BudgetCheck) *estimator.BudgetCheck {
+	for i := range checks {
+		if checks[i].Exceeded {
+			return &checks[i]
+		}
+	}
+	return nil
+}
+
+// enforceBudgets exits with status 6 when a projected monthly cost exceeds its budget.
+func enforceBudgets(checks []estimator.BudgetCheck) {
+	if c := exceededBudget(checks); c != nil {
+		slog.Error("projected monthly cost exceeds --budget-usd", "model", c.Model, "monthly_usd", c.MonthlyUSD, "budget_usd", c.BudgetUSD)
+		os.Exit(exitBudget)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	model "pr-agent-cost-estimator/internal/model"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// budgetAnalysis is a one-month analysis at one token per char: big costs $7.50 and small $2.50
+// a month at A ($5/M), a fifth of that at B ($1/M). With orgs set it covers several orgs.
+func budgetAnalysis(orgs ...string) *estimator.Analysis {
+	a := &estimator.Analysis{}
+	a.Title, a.Window = "acme", "2024-01-01 – 2024-01-31"
+	a.TokensPerChar = 1
+	a.Org = model.OrgSummary{MonthsSpan: 1, AvgMonthlyTokens: 2000000}
+	a.Repos = []model.RepoSummary{{Org: "acme", RepoName: "big", TotalDiffChars: 1500000}, {Org: "acme", RepoName: "small", TotalDiffChars: 500000}}
+	a.Pricing = []estimator.Price{{Name: "A", USDPerM: 5}, {Name: "B", USDPerM: 1}}
+	for _, o := range orgs {
+		a.OrgTotals = append(a.OrgTotals, model.OrgSubtotal{Org: o})
+	}
+	return a
+}
+
+// TestBudgetAlertWebhook posts an over-budget alert to a test webhook and checks the JSON it
+// receives and that the run would exit with status 6.
+func TestBudgetAlertWebhook(t *testing.T) {
+	var got budgetAlert
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/hooks/T000/SECRET" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	a := budgetAnalysis()
+	b := budgetOptions{USD: stringList{"8", "B:100"}, RepoPct: 50, Webhook: srv.URL + "/hooks/T000/SECRET"}
+	checks := checkBudgets(a, parseBudgets(b, a.Pricing), b.RepoPct)
+	alert := newBudgetAlert(a, checks, b.RepoPct)
+	if alert == nil {
+		t.Fatal("no alert for an exceeded budget")
+	}
+	if err := sendBudgetAlert(srv.Client(), b.Webhook, alert); err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if got.Title != "acme" || got.Window != a.Window || !got.Exceeded || got.GeneratedAt.IsZero() {
+		t.Errorf("alert = %+v", got)
+	}
+	if len(got.Budgets) != 2 {
+		t.Fatalf("budgets = %+v, want A and B", got.Budgets)
+	}
+	if c := got.Budgets[0]; c.Model != "A" || c.BudgetUSD != 8 || c.MonthlyUSD != 10 || !c.Exceeded || len(c.Repos) != 1 || c.Repos[0].Repo != "big" || c.Repos[0].Org != "acme" {
+		t.Errorf("A check = %+v, want $10 of $8 exceeded with big flagged", c)
+	}
+	if c := got.Budgets[1]; c.Model != "B" || c.BudgetUSD != 100 || c.Exceeded || len(c.Repos) != 0 {
+		t.Errorf("B check = %+v, want $2 of $100 within budget", c)
+	}
+	want := "AI review budget for acme (" + a.Window + "): exceeded by A $10.00/month vs $8.00 (125%); repositories above 50% of the budget: big"
+	if got.Text != want {
+		t.Errorf("text = %q, want %q", got.Text, want)
+	}
+
+	if c := exceededBudget(checks); c == nil || c.Model != "A" {
+		t.Errorf("exceededBudget = %+v, want A: the run exits with status 6", c)
+	}
+}
+
+// TestBudgetWithinLimits checks that a budget that holds sends nothing and does not fail the run.
+func TestBudgetWithinLimits(t *testing.T) {
+	a := budgetAnalysis()
+	checks := checkBudgets(a, []estimator.Budget{{USD: 50}}, 50)
+	if alert := newBudgetAlert(a, checks, 50); alert != nil {
+		t.Errorf("alert = %+v, want none", alert)
+	}
+	if c := exceededBudget(checks); c != nil {
+		t.Errorf("exceededBudget = %+v, want nil: the run exits normally", c)
+	}
+	if c := exceededBudget(nil); c != nil {
+		t.Errorf("exceededBudget without a budget = %+v", c)
+	}
+
+	// A flagged repository alone alerts without failing the run
+	checks = checkBudgets(a, []estimator.Budget{{Model: "A", USD: 12}}, 50)
+	alert := newBudgetAlert(a, checks, 50)
+	if alert == nil || alert.Exceeded || !strings.HasSuffix(alert.Text, "repositories above 50% of the budget: big") {
+		t.Errorf("alert = %+v, want big flagged without exceeding", alert)
+	}
+	if exceededBudget(checks) != nil {
+		t.Error("a flagged repository fails the run")
+	}
+}
+
+func TestSendBudgetAlertErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	alert := &budgetAlert{Text: "x"}
+	err := sendBudgetAlert(srv.Client(), srv.URL+"/hooks/SECRET", alert)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("rejected alert: err = %v, want the status", err)
+	}
+	srv.Close()
+	client := &http.Client{Timeout: time.Second}
+	err = sendBudgetAlert(client, srv.URL+"/hooks/SECRET", alert)
+	if err == nil {
+		t.Fatal("posting to a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("error %q leaks the webhook URL", err)
+	}
+}
+
+// TestRepoBudgetNames checks that the run summary, the webhook alert and the HTML report name
+// flagged repositories alike: bare for one org, org/name for several.
+func TestRepoBudgetNames(t *testing.T) {
+	for _, tt := range []struct {
+		orgs  []string
+		want  string
+		wrong string
+	}{
+		{nil, "big", "acme/big"},
+		{[]string{"acme", "beta"}, "acme/big", ""},
+	} {
+		a := budgetAnalysis(tt.orgs...)
+		checks := checkBudgets(a, []estimator.Budget{{Model: "A", USD: 8}}, 50)
+		multiOrg := len(tt.orgs) > 0
+
+		var summary strings.Builder
+		printBudgets(&summary, checks, multiOrg)
+		if !strings.Contains(summary.String(), "   - "+tt.want+": $7.50/month") {
+			t.Errorf("orgs %v: summary = %q, want %s", tt.orgs, summary.String(), tt.want)
+		}
+		if alert := newBudgetAlert(a, checks, 50); !strings.HasSuffix(alert.Text, ": "+tt.want) {
+			t.Errorf("orgs %v: alert text = %q, want %s", tt.orgs, alert.Text, tt.want)
+		}
+
+		data := newReportData(a)
+		data.Budgets = checks
+		out := filepath.Join(t.TempDir(), "report.html")
+		if err := renderHTMLReport(out, data); err != nil {
+			t.Fatal(err)
+		}
+		html, _ := os.ReadFile(out)
+		if !strings.Contains(string(html), `<td class="mono">`+tt.want+`</td>`) {
+			t.Errorf("orgs %v: report does not name %s", tt.orgs, tt.want)
+		}
+		if tt.wrong != "" && strings.Contains(string(html), tt.wrong) {
+			t.Errorf("orgs %v: report names %s", tt.orgs, tt.wrong)
+		}
+	}
+}
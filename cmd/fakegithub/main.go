@@ -0,0 +1,106 @@
+// Command fakegithub serves a small demo organization through the offline fake GitHub API so the
+// estimator can be run end to end without network access or a token:
+//
+//	go run ./cmd/fakegithub &
+//	./pr-agent-cost-estimator --org demo --api-url http://127.0.0.1:PORT/ --out report.html
+//
+// With -app-id and -app-key it also accepts that GitHub App, so --github-app-id and
+// --github-app-key can be tried with the same key:
+//
+//	go run ./cmd/fakegithub -app-id 1 -app-key app.pem &
+//	./pr-agent-cost-estimator --org demo --api-url http://127.0.0.1:PORT/ --github-app-id 1 --github-app-key app.pem
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	fakegithub "pr-agent-cost-estimator/internal/fakegithub"
+	ghapp "pr-agent-cost-estimator/internal/ghapp"
+)
+
+func main() {
+	var org string
+	var repos, prsPerRepo int
+	var appID int64
+	var appKey string
+	flag.StringVar(&org, "org", "demo", "Organization name to serve")
+	flag.IntVar(&repos, "repos", 3, "Number of repositories")
+	flag.IntVar(&prsPerRepo, "prs", 120, "Pull requests per repository (more than 100 exercises pagination)")
+	flag.Int64Var(&appID, "app-id", 0, "GitHub App ID to accept (requires -app-key)")
+	flag.StringVar(&appKey, "app-key", "", "Private key PEM of the app; the server verifies its JWTs with the public half")
+	flag.Parse()
+
+	srv := fakegithub.New(demoOrg(org, repos, prsPerRepo))
+	defer srv.Close()
+	if appID != 0 {
+		key, err := ghapp.LoadPrivateKey(appKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "fakegithub: -app-key:", err)
+			os.Exit(2)
+		}
+		srv.InstallApp(fakegithub.App{ID: appID, Slug: "cost-estimator", Key: &key.PublicKey})
+	}
+	fmt.Printf("Fake GitHub API for org %q listening on %s/\n", org, srv.URL)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+}
+
+// demoOrg builds repositories with a year of PRs, including bots, drafts, unmerged PRs and
+// diffs that fail with 403, 404, 451 and transient 502s.
+func demoOrg(login string, repos, prs int) *fakegithub.Org {
+	o := &fakegithub.Org{Login: login}
+	start := time.Now().AddDate(-1, 0, 0)
+	for r := 0; r < repos; r++ {
+		repo := &fakegithub.Repo{Name: fmt.Sprintf("service-%d", r+1), Private: r%2 == 1, Language: "Go"}
+		for i := 1; i <= prs; i++ {
+			created := start.Add(time.Duration(i) * 365 * 24 * time.Hour / time.Duration(prs+1))
+			pr := &fakegithub.PR{
+				Number:    i,
+				Title:     fmt.Sprintf("Change %d", i),
+				CreatedAt: created,
+				Author:    fmt.Sprintf("dev%d", i%5),
+				Diff:      demoDiff(i),
+			}
+			switch {
+			case i%10 == 0:
+				pr.Author, pr.Bot, pr.Title = "dependabot[bot]", true, "chore(deps): bump"
+			case i%7 == 0:
+				pr.State = "closed" // closed without merging
+			case i%11 == 0:
+				pr.Draft = true
+			default:
+				pr.MergedAt = created.Add(24 * time.Hour)
+			}
+			switch i {
+			case 3:
+				pr.DiffStatus = http.StatusForbidden
+			case 5:
+				pr.DiffStatus = http.StatusNotFound
+			case 8:
+				pr.DiffStatus = http.StatusUnavailableForLegalReasons
+			case 9:
+				pr.FailTimes = 1
+			}
+			repo.PRs = append(repo.PRs, pr)
+		}
+		o.Repos = append(o.Repos, repo)
+	}
+	return o
+}
+
+func demoDiff(n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/file%d.go b/file%d.go\n--- a/file%d.go\n+++ b/file%d.go\n@@ -1,3 +1,%d @@\n", n, n, n, n, n%40+3)
+	for i := 0; i < n%40+3; i++ {
+		fmt.Fprintf(&b, "+\tvalue%d := compute(%d) // generated line\n", i, i)
+	}
+	return b.String()
+}
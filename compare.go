@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// compareRepoRows is the number of per-repository changes printed by compare.
+const compareRepoRows = 10
+
+// printComparison writes org-level deltas between two analyses, costs matched by price name,
+// and the repositories whose diff volume changed most.
+func printComparison(w io.Writer, old, cur *estimator.Analysis) {
+	fmt.Fprintf(w, "Comparing %s (window: %s) → %s (window: %s)\n", old.Title, old.Window, cur.Title, cur.Window)
+	row := func(label string, a, b float64, format string) {
+		delta := ""
+		if a != 0 {
+			delta = fmt.Sprintf(" (%+.1f%%)", (b-a)/a*100)
+		}
+		fmt.Fprintf(w, " - %s: "+format+" → "+format+"%s\n", label, a, b, delta)
+	}
+	row("Total PRs", float64(old.Org.TotalPRs), float64(cur.Org.TotalPRs), "%.0f")
+	row("Total diff chars", float64(old.Org.TotalDiffChars), float64(cur.Org.TotalDiffChars), "%.0f")
+	row("Avg monthly PRs", old.Org.AvgMonthlyPRs, cur.Org.AvgMonthlyPRs, "%.2f")
+	row("Avg monthly tokens (est)", float64(old.Org.AvgMonthlyTokens), float64(cur.Org.AvgMonthlyTokens), "%.0f")
+	row("Tokens per char", old.TokensPerChar, cur.TokensPerChar, "%.3f")
+	oldCost := map[string]float64{}
+	for _, c := range old.Costs {
+		oldCost[c.Name] = c.MonthlyUSD
+	}
+	for _, c := range cur.Costs {
+		if prev, ok := oldCost[c.Name]; ok {
+			row("Est. monthly cost ("+c.Name+")", prev, c.MonthlyUSD, "$%.2f")
+		} else {
+			fmt.Fprintf(w, " - Est. monthly cost (%s): - → $%.2f\n", c.Name, c.MonthlyUSD)
+		}
+	}
+	row("Data completeness %", old.Org.DataCompletenessPct, cur.Org.DataCompletenessPct, "%.1f")
+
+	type change struct {
+		name        string
+		oldPRs      int
+		newPRs      int
+		oldChars    int64
+		newChars    int64
+		absDelta    int64
+		onlyOneSide string
+	}
+	key := func(org, repo string) string { return org + "/" + repo }
+	byRepo := map[string]*change{}
+	for _, r := range old.Repos {
+		byRepo[key(r.Org, r.RepoName)] = &change{name: key(r.Org, r.RepoName), oldPRs: r.TotalPRs, oldChars: r.TotalDiffChars, onlyOneSide: "removed"}
+	}
+	for _, r := range cur.Repos {
+		c, ok := byRepo[key(r.Org, r.RepoName)]
+		if !ok {
+			c = &change{name: key(r.Org, r.RepoName), onlyOneSide: "added"}
+			byRepo[c.name] = c
+		} else {
+			c.onlyOneSide = ""
+		}
+		c.newPRs, c.newChars = r.TotalPRs, r.TotalDiffChars
+	}
+	var changes []*change
+	for _, c := range byRepo {
+		c.absDelta = c.newChars - c.oldChars
+		if c.absDelta < 0 {
+			c.absDelta = -c.absDelta
+		}
+		if c.absDelta != 0 || c.onlyOneSide != "" {
+			changes = append(changes, c)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].absDelta != changes[j].absDelta {
+			return changes[i].absDelta > changes[j].absDelta
+		}
+		return changes[i].name < changes[j].name
+	})
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nLargest per-repo changes by diff chars:")
+	for i, c := range changes {
+		if i == compareRepoRows {
+			fmt.Fprintf(w, " - ... and %d more\n", len(changes)-compareRepoRows)
+			break
+		}
+		note := ""
+		if c.onlyOneSide != "" {
+			note = " [" + c.onlyOneSide + "]"
+		}
+		fmt.Fprintf(w, " - %s: PRs %d → %d, diff chars %d → %d%s\n", c.name, c.oldPRs, c.newPRs, c.oldChars, c.newChars, note)
+	}
+}
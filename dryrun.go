@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+	api "pr-agent-cost-estimator/internal/api"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// assumedCallLatency is the average GitHub REST round trip used for runtime projections.
+const assumedCallLatency = 300 * time.Millisecond
+
+// assumedTokensPerChar is a typical tiktoken ratio for code diffs (see VALIDATION.md: 0.2–0.6).
+const assumedTokensPerChar = 0.3
+
+// dryRunPlan is the projected cost of a full crawl.
+type dryRunPlan struct {
+	ListCalls     int
+	DiffCalls     int
+	RateWaits     int
+	RateWaitTime  time.Duration
+	CallTime      time.Duration
+	Runtime       time.Duration
+	CappedWaits   bool // a reset is further away than the wait cap, so waits would be cut short
+	MonthlyPRs    float64
+	MonthlyTokens int64
+	Costs         []estimator.Cost
+}
+
+// runDryRun counts PRs per repository via the search API (no PR listing, no diffs) and prints
+// the projected API calls, rate-limit waits, runtime and a rough monthly cost at each price to w.
+// In fast mode only the calibration diffs are projected. Nil pricing means DefaultPricing.
+func runDryRun(ctx context.Context, w io.Writer, collector *api.Collector, repos []*github.Repository, label func(*github.Repository) string, since, until *time.Time, filter *api.PRFilter, charsPerPR int, fast bool, calibrationPRs int, pricing []estimator.Price) {
+	if len(pricing) == 0 {
+		pricing = estimator.DefaultPricing
+	}
+	fmt.Fprintf(w, "\nDry run: counting PRs for %d repositories (search API, no diffs fetched)\n", len(repos))
+	var totalPRs, windowPRs int
+	var first time.Time
+	var plan dryRunPlan
+	for _, r := range repos {
+		if ctx.Err() != nil {
+			slog.Warn("dry run interrupted")
+			break
+		}
+		cnt, err := collector.CountPRs(ctx, repoOwner(r), r.GetName(), since, until, filter)
+		if err != nil {
+			slog.Warn("failed to count PRs", "repo", label(r), "err", err)
+			continue
+		}
+		fmt.Fprintf(w, " - %s: PRs=%d, in window=%d\n", label(r), cnt.Total, cnt.InWindow)
+		totalPRs += cnt.Total
+		windowPRs += cnt.InWindow
+		if !cnt.FirstCreated.IsZero() && (first.IsZero() || cnt.FirstCreated.Before(first)) {
+			first = cnt.FirstCreated
+		}
+		pages := (cnt.Total + 99) / 100
+		if pages < 1 {
+			pages = 1
+		}
+		plan.ListCalls += pages
+		if fast && cnt.InWindow > calibrationPRs {
+			plan.DiffCalls += calibrationPRs
+		} else {
+			plan.DiffCalls += cnt.InWindow
+		}
+	}
+
+	rate, err := collector.CoreRateLimit(ctx)
+	if err != nil {
+		slog.Warn("failed to read core rate limit; assuming 5000/hour", "err", err)
+		rate = &github.Rate{Limit: 5000, Remaining: 5000, Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}
+	}
+	projectCrawl(&plan, collector.Policy(), rate, time.Now())
+
+	last := time.Now()
+	if until != nil {
+		last = *until
+	}
+	if months := estimator.MonthsSpan(first, last); months > 0 {
+		plan.MonthlyPRs = float64(windowPRs) / float64(months)
+	}
+	plan.MonthlyTokens = int64(math.Round(plan.MonthlyPRs * float64(charsPerPR) * assumedTokensPerChar))
+	plan.Costs = estimator.Costs(plan.MonthlyTokens, pricing)
+
+	fmt.Fprintf(w, "\nDry-run projection\n")
+	fmt.Fprintf(w, " - PRs: %d total, %d in window (search qualifiers only; other exclusion rules apply during the crawl)\n", totalPRs, windowPRs)
+	if fast {
+		fmt.Fprintf(w, " - Projected API calls: %d (GraphQL PR pages: %d, calibration diffs: %d, up to %d per repository)\n", plan.ListCalls+plan.DiffCalls, plan.ListCalls, plan.DiffCalls, calibrationPRs)
+	} else {
+		fmt.Fprintf(w, " - Projected API calls: %d (PR list pages: %d, diffs: %d)\n", plan.ListCalls+plan.DiffCalls, plan.ListCalls, plan.DiffCalls)
+	}
+	fmt.Fprintf(w, " - Core rate limit: %d/%d remaining, resets at %s\n", rate.Remaining, rate.Limit, rate.Reset.Time.Format(time.RFC3339))
+	fmt.Fprintf(w, " - Expected rate-limit waits: %d (≈%s)\n", plan.RateWaits, plan.RateWaitTime.Round(time.Minute))
+	fmt.Fprintf(w, " - Projected runtime: ≈%s (calls ≈%s at %s latency + jitter)\n", plan.Runtime.Round(time.Minute), plan.CallTime.Round(time.Minute), assumedCallLatency)
+	if plan.CappedWaits {
+		fmt.Fprintln(w, " - WARNING: rate-limit resets exceed the --max-wait-reset cap; capped waits retry early and may leave diffs failed (consider --eventual-complete --max-wait-reset=\"\")")
+	}
+	fmt.Fprintf(w, " - Rough monthly estimate (assuming %d diff chars/PR, %.2f tokens/char): PRs/month=%.1f, tokens/month=%d\n",
+		charsPerPR, assumedTokensPerChar, plan.MonthlyPRs, plan.MonthlyTokens)
+	for _, c := range plan.Costs {
+		fmt.Fprintf(w, "   - %s: $%.2f\n", c.Name, c.MonthlyUSD)
+	}
+}
+
+// projectCrawl fills in call time, rate-limit waits and runtime for plan under policy p, given
+// the current core rate limit.
+func projectCrawl(plan *dryRunPlan, p api.Policy, rate *github.Rate, now time.Time) {
+	calls := plan.ListCalls + plan.DiffCalls
+	perCall := assumedCallLatency
+	if p.SleepMax > 0 {
+		perCall += (p.SleepMin + p.SleepMax) / 2
+	}
+	plan.CallTime = time.Duration(calls) * perCall
+
+	reserve := 0
+	if p.Throttle {
+		reserve = int(math.Ceil(p.ReserveFraction * float64(rate.Limit)))
+	}
+	usableNow := rate.Remaining - reserve
+	usablePerHour := rate.Limit - reserve
+	if usableNow < 0 {
+		usableNow = 0
+	}
+	plan.Runtime = plan.CallTime
+	if calls <= usableNow || usablePerHour <= 0 {
+		return
+	}
+	// First wait is until the current reset, then one full hour per additional window
+	over := calls - usableNow
+	plan.RateWaits = (over + usablePerHour - 1) / usablePerHour
+	untilReset := rate.Reset.Time.Sub(now)
+	if untilReset < 0 {
+		untilReset = 0
+	}
+	plan.RateWaitTime = untilReset + time.Duration(plan.RateWaits-1)*time.Hour
+	// Calls and waits overlap: the crawl cannot finish before the last window opens
+	lastWindowCalls := over - (plan.RateWaits-1)*usablePerHour
+	if minRuntime := plan.RateWaitTime + time.Duration(lastWindowCalls)*perCall; minRuntime > plan.Runtime {
+		plan.Runtime = minRuntime
+	}
+	capDur := p.MaxWaitReset
+	if !p.EventualComplete && capDur == 0 {
+		capDur = 2 * time.Minute
+	}
+	plan.CappedWaits = capDur > 0 && (untilReset > capDur || (plan.RateWaits > 1 && time.Hour > capDur))
+}
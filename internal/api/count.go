@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+)
+
+// PRCount is a cheap PR count for one repository, taken from the search API without listing PRs.
+type PRCount struct {
+	Total        int       // all PRs (drives the number of PR list pages)
+	InWindow     int       // PRs in the createdAt window matching the searchable filters (drives diff fetches)
+	FirstCreated time.Time // earliest createdAt among InWindow PRs
+}
+
+// CountPRs counts PRs with one search API call per repository: InWindow is the search's
+// total_count. Only filters expressible as search qualifiers (merged-only, drafts, a single exact
+// base branch) are applied to it; the remaining PRFilter rules are only evaluated during a real
+// crawl. Total comes from the last page number of a one-PR-per-page list, a core API call, so
+// the 30/minute search limit is not spent on it.
+func (c *Collector) CountPRs(ctx context.Context, owner, repo string, since, until *time.Time, filter *PRFilter) (PRCount, error) {
+	base := fmt.Sprintf("repo:%s/%s is:pr", owner, repo)
+	var out PRCount
+
+	q := base
+	if since != nil || until != nil {
+		// Exact instants keep the search consistent with the crawl's window (time zone,
+		// inclusive end of day); the qualifier accepts ISO 8601 times with offsets
+		from, to := "*", "*"
+		if since != nil {
+			from = since.Format("2006-01-02T15:04:05Z07:00")
+		}
+		if until != nil {
+			to = until.Format("2006-01-02T15:04:05Z07:00")
+		}
+		q += fmt.Sprintf(" created:%s..%s", from, to)
+	}
+	if filter != nil {
+		if filter.MergedOnly {
+			q += " is:merged"
+		}
+		if filter.ExcludeDrafts {
+			q += " draft:false"
+		}
+		if len(filter.BaseBranches) == 1 && !strings.ContainsAny(filter.BaseBranches[0].Pattern, "*?") {
+			q += " base:" + filter.BaseBranches[0].Pattern
+		}
+	}
+	n, first, err := c.searchCount(ctx, q)
+	if err != nil {
+		return out, err
+	}
+	out.InWindow, out.FirstCreated = n, first
+	if q == base {
+		out.Total = n
+		return out, nil
+	}
+	c.sleepJitter(ctx)
+	out.Total, err = c.totalPRs(ctx, owner, repo)
+	return out, err
+}
+
+// totalPRs returns the number of PRs in a repository (state=all) from the list endpoint's
+// pagination: with one PR per page, the last page number is the count.
+func (c *Collector) totalPRs(ctx context.Context, owner, repo string) (int, error) {
+	opt := &github.PullRequestListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 1}}
+	for {
+		c.pace(ctx)
+		prs, resp, err := c.client.PullRequests.List(ctx, owner, repo, opt)
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", owner+"/"+repo) {
+				continue
+			}
+			return 0, err
+		}
+		if resp.LastPage > 0 {
+			return resp.LastPage, nil
+		}
+		return len(prs), nil
+	}
+}
+
+// searchCount returns total_count for an issue search and the createdAt of the oldest match.
+func (c *Collector) searchCount(ctx context.Context, query string) (int, time.Time, error) {
+	opt := &github.SearchOptions{Sort: "created", Order: "asc", ListOptions: github.ListOptions{PerPage: 1}}
+	for {
+		res, resp, err := c.client.Search.Issues(ctx, query, opt)
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "query", query) {
+				continue
+			}
+			return 0, time.Time{}, err
+		}
+		var first time.Time
+		if len(res.Issues) > 0 {
+			first = res.Issues[0].GetCreatedAt().Time
+		}
+		return res.GetTotal(), first, nil
+	}
+}
+
+// CoreRateLimit returns the current core REST rate limit. The rate_limit endpoint does not
+// count against the limit.
+func (c *Collector) CoreRateLimit(ctx context.Context) (*github.Rate, error) {
+	limits, _, err := c.client.RateLimit.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return limits.GetCore(), nil
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+	httpcache "pr-agent-cost-estimator/internal/httpcache"
+)
+
+// DefaultCharsPerLine models a changed diff line when a repository has no usable calibration
+// sample (every sampled diff skipped or failed, or no PR with line changes).
+const DefaultCharsPerLine = 40.0
+
+// Calibration describes how a repository's chars-per-line ratio was derived in fast mode.
+type Calibration struct {
+	SamplePRs    int     `json:"samplePRs"`    // PRs whose raw diff was fetched for calibration
+	SampleChars  int64   `json:"sampleChars"`  // raw diff chars of the sample
+	SampleLines  int64   `json:"sampleLines"`  // additions+deletions of the sample
+	CharsPerLine float64 `json:"charsPerLine"` // SampleChars/SampleLines, or DefaultCharsPerLine without a sample
+	ErrorPct     float64 `json:"errorPct"`     // leave-one-out mean absolute % error of per-PR estimates; -1 if unknown
+}
+
+// prLines is a PR kept or excluded during a fast crawl, awaiting its modeled diff size.
+type prLines struct {
+	number  int
+	created time.Time
+	login   string
+	lines   int64
+	closed  bool
+	rule    string // exclusion rule, "" if counted
+}
+
+// RepoPRLineStats is the fast counterpart of RepoPRDiffStats. PRs are listed through the GraphQL
+// API (100 per call) together with their additions and deletions, and each PR's diff chars are
+// modeled as changed lines × a chars-per-line ratio calibrated on up to calibrationSample raw
+// diffs spread over the repository's PRs. Calibration diffs also feed sampleBuf.
+// Only the calibration diffs count against the core REST budget. DiffsSkipped/DiffsFailed stay
+// zero since every PR gets an estimate; see RepoStats.Calibration for the model's error.
+func (c *Collector) RepoPRLineStats(ctx context.Context, owner, repo string, since, until *time.Time, filter *PRFilter, calibrationSample int, sampleBudget *int64, sampleBuf *strings.Builder) (*RepoStats, error) {
+	stats := &RepoStats{ByAuthor: map[string]*AuthorStats{}, Excluded: map[string]*ExclusionStats{}}
+	var prs []prLines
+	var listErr error
+	var cursor *string
+	for done := false; !done; {
+		page, err := c.graphQLPRPage(ctx, owner, repo, cursor)
+		if err != nil {
+			if ctx.Err() == nil {
+				return nil, err
+			}
+			listErr = ctx.Err()
+			break
+		}
+		for _, n := range page.Nodes {
+			created := n.CreatedAt
+			if created.IsZero() || (since != nil && created.Before(*since)) {
+				continue
+			}
+			if until != nil && created.After(*until) {
+				done = true // ordered by creation: nothing later is in the window
+				break
+			}
+			c.recordPRProcessed()
+			pr := n.pullRequest()
+			prs = append(prs, prLines{
+				number:  n.Number,
+				created: created,
+				login:   pr.GetUser().GetLogin(),
+				lines:   int64(n.Additions + n.Deletions),
+				closed:  n.State != "OPEN",
+				rule:    filter.Match(pr),
+			})
+		}
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &page.PageInfo.EndCursor
+		c.sleepJitter(ctx)
+	}
+
+	cal := c.calibrate(ctx, owner, repo, prs, calibrationSample, sampleBudget, sampleBuf)
+	stats.Calibration = &cal
+	for _, p := range prs {
+		chars := int64(math.Round(float64(p.lines) * cal.CharsPerLine))
+		rec := PRRecord{Number: p.number, Author: p.login, CreatedAt: p.created, DiffChars: chars, Lines: p.lines}
+		if p.rule != "" {
+			ex, ok := stats.Excluded[p.rule]
+			if !ok {
+				ex = &ExclusionStats{}
+				stats.Excluded[p.rule] = ex
+			}
+			ex.PRs++
+			rec.Excluded = p.rule
+			if filter.MeasureExcluded {
+				ex.DiffChars += chars
+			} else {
+				rec.DiffChars = 0
+			}
+			stats.PRs = append(stats.PRs, rec)
+			continue
+		}
+		stats.PRs = append(stats.PRs, rec)
+		stats.PRCount++
+		if stats.First.IsZero() || p.created.Before(stats.First) {
+			stats.First = p.created
+		}
+		if stats.Last.IsZero() || p.created.After(stats.Last) {
+			stats.Last = p.created
+		}
+		stats.DiffChars += chars
+		stats.addAuthor(p.login, chars)
+	}
+	if listErr == nil {
+		listErr = ctx.Err()
+	}
+	return stats, listErr
+}
+
+// calibrate fetches raw diffs for up to n counted PRs with line changes, evenly spaced over
+// creation time, and derives the chars-per-line ratio and its leave-one-out error.
+func (c *Collector) calibrate(ctx context.Context, owner, repo string, prs []prLines, n int, sampleBudget *int64, sampleBuf *strings.Builder) Calibration {
+	cal := Calibration{CharsPerLine: DefaultCharsPerLine, ErrorPct: -1}
+	var candidates []prLines
+	for _, p := range prs {
+		if p.rule == "" && p.lines > 0 {
+			candidates = append(candidates, p)
+		}
+	}
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	type sample struct{ chars, lines int64 }
+	var samples []sample
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		p := candidates[i*len(candidates)/n]
+		dctx := ctx
+		if p.closed {
+			dctx = httpcache.WithImmutable(ctx)
+		}
+		diff, outcome := c.fetchPRDiff(dctx, owner, repo, p.number)
+		c.sleepJitter(ctx)
+		if outcome != diffOK || len(diff) == 0 {
+			continue
+		}
+		samples = append(samples, sample{chars: int64(len(diff)), lines: p.lines})
+		cal.SampleChars += int64(len(diff))
+		cal.SampleLines += p.lines
+		if sampleBudget != nil && sampleBuf != nil && *sampleBudget > 0 {
+			end := len(diff)
+			if int64(end) > *sampleBudget {
+				end = int(*sampleBudget)
+			}
+			sampleBuf.WriteString(diff[:end])
+			*sampleBudget -= int64(end)
+		}
+	}
+	cal.SamplePRs = len(samples)
+	if cal.SampleLines == 0 {
+		return cal
+	}
+	cal.CharsPerLine = float64(cal.SampleChars) / float64(cal.SampleLines)
+	if len(samples) < 2 {
+		return cal
+	}
+	// Predict each sampled PR from the ratio of the others so the error is not in-sample
+	var errSum float64
+	var errN int
+	for _, s := range samples {
+		restLines := cal.SampleLines - s.lines
+		if restLines <= 0 {
+			continue
+		}
+		ratio := float64(cal.SampleChars-s.chars) / float64(restLines)
+		errSum += math.Abs(ratio*float64(s.lines)-float64(s.chars)) / float64(s.chars)
+		errN++
+	}
+	if errN > 0 {
+		cal.ErrorPct = 100 * errSum / float64(errN)
+	}
+	return cal
+}
+
+const prLinesQuery = `query($owner: String!, $name: String!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(first: 100, after: $cursor, orderBy: {field: CREATED_AT, direction: ASC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number title state isDraft createdAt mergedAt baseRefName headRefName additions deletions
+        author { login __typename }
+        labels(first: 50) { nodes { name } }
+      }
+    }
+  }
+}`
+
+// gqlPRNode is one PR as returned by prLinesQuery.
+type gqlPRNode struct {
+	Number      int        `json:"number"`
+	Title       string     `json:"title"`
+	State       string     `json:"state"` // OPEN, CLOSED or MERGED
+	IsDraft     bool       `json:"isDraft"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	MergedAt    *time.Time `json:"mergedAt"`
+	BaseRefName string     `json:"baseRefName"`
+	HeadRefName string     `json:"headRefName"`
+	Additions   int        `json:"additions"`
+	Deletions   int        `json:"deletions"`
+	Author      *struct {
+		Login    string `json:"login"`
+		Typename string `json:"__typename"`
+	} `json:"author"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+}
+
+// pullRequest converts the node to the REST shape so PRFilter rules apply unchanged.
+func (n *gqlPRNode) pullRequest() *github.PullRequest {
+	state := "closed"
+	if n.State == "OPEN" {
+		state = "open"
+	}
+	pr := &github.PullRequest{
+		Number:    github.Int(n.Number),
+		Title:     github.String(n.Title),
+		State:     github.String(state),
+		Draft:     github.Bool(n.IsDraft),
+		CreatedAt: &github.Timestamp{Time: n.CreatedAt},
+		Base:      &github.PullRequestBranch{Ref: github.String(n.BaseRefName)},
+		Head:      &github.PullRequestBranch{Ref: github.String(n.HeadRefName)},
+	}
+	if n.MergedAt != nil {
+		pr.MergedAt = &github.Timestamp{Time: *n.MergedAt}
+	}
+	if n.Author != nil {
+		userType := "User"
+		if n.Author.Typename == "Bot" {
+			userType = "Bot"
+		}
+		pr.User = &github.User{Login: github.String(n.Author.Login), Type: github.String(userType)}
+	}
+	for _, l := range n.Labels.Nodes {
+		pr.Labels = append(pr.Labels, &github.Label{Name: github.String(l.Name)})
+	}
+	return pr
+}
+
+type gqlPRPage struct {
+	PageInfo struct {
+		HasNextPage bool   `json:"hasNextPage"`
+		EndCursor   string `json:"endCursor"`
+	} `json:"pageInfo"`
+	Nodes []gqlPRNode `json:"nodes"`
+}
+
+// graphQLPRPage fetches one page of prLinesQuery, waiting out rate limits per policy. GraphQL
+// has its own points budget, so these calls are not paced against the core REST budget.
+func (c *Collector) graphQLPRPage(ctx context.Context, owner, repo string, cursor *string) (*gqlPRPage, error) {
+	body := map[string]any{
+		"query":     prLinesQuery,
+		"variables": map[string]any{"owner": owner, "name": repo, "cursor": cursor},
+	}
+	for {
+		req, err := c.client.NewRequest("POST", c.graphQLPath(), body)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Data struct {
+				Repository *struct {
+					PullRequests gqlPRPage `json:"pullRequests"`
+				} `json:"repository"`
+			} `json:"data"`
+			Errors []struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		resp, err := c.client.Do(ctx, req, &out)
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", owner+"/"+repo, "api", "graphql") {
+				continue
+			}
+			return nil, err
+		}
+		if len(out.Errors) > 0 {
+			if out.Errors[0].Type == "RATE_LIMITED" && !resp.Rate.Reset.Time.IsZero() {
+				wait := resp.Rate.Reset.Time.Sub(c.now())
+				if wait <= 0 {
+					wait = 5 * time.Second
+				}
+				if c.waitWithCap(ctx, wait, "repo", owner+"/"+repo, "api", "graphql", "source", "rate-reset") == nil {
+					continue
+				}
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("graphql %s/%s: %s", owner, repo, out.Errors[0].Message)
+		}
+		if out.Data.Repository == nil {
+			return nil, fmt.Errorf("graphql %s/%s: repository not found", owner, repo)
+		}
+		return &out.Data.Repository.PullRequests, nil
+	}
+}
+
+// graphQLPath resolves the GraphQL endpoint against the client's base URL. GitHub Enterprise
+// Server serves REST under /api/v3/ but GraphQL under /api/graphql.
+func (c *Collector) graphQLPath() string {
+	if strings.HasSuffix(c.client.BaseURL.Path, "/api/v3/") {
+		return strings.TrimSuffix(c.client.BaseURL.Path, "v3/") + "graphql"
+	}
+	return "graphql"
+}
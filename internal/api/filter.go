@@ -0,0 +1,292 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	github "github.com/google/go-github/v61/github"
+)
+
+// PRFilter holds rules that exclude PRs before their diff is fetched.
+// Rules are evaluated in declaration order and the first match names the exclusion.
+type PRFilter struct {
+	MergedOnly            bool             // keep only merged PRs
+	ExcludeClosedUnmerged bool             // drop PRs closed without merging
+	ExcludeDrafts         bool             // drop draft PRs
+	BaseBranches          []Glob           // keep only PRs whose base branch matches one of these globs
+	ExcludeBots           bool             // author user type "Bot" (dependabot[bot], renovate[bot], ...)
+	LoginPatterns         []Glob           // author login globs, built with Globs(..., true) to ignore case
+	Labels                []string         // label names, case-insensitive
+	HeadBranches          []Glob           // head branch globs, e.g. "renovate/*"
+	TitlePatterns         []*regexp.Regexp // PR title regexes
+	MeasureExcluded       bool             // still fetch diffs of excluded PRs to report excluded chars
+}
+
+// ExclusionStats counts PRs (and optionally diff chars) dropped by one rule.
+type ExclusionStats struct {
+	PRs       int
+	DiffChars int64
+}
+
+// Match returns the name of the first rule that excludes pr, or "" if the PR is kept.
+func (f *PRFilter) Match(pr *github.PullRequest) string {
+	if f == nil || pr == nil {
+		return ""
+	}
+	merged := pr.MergedAt != nil && !pr.GetMergedAt().IsZero()
+	if f.MergedOnly && !merged {
+		return "not-merged"
+	}
+	if f.ExcludeClosedUnmerged && pr.GetState() == "closed" && !merged {
+		return "closed-unmerged"
+	}
+	if f.ExcludeDrafts && pr.GetDraft() {
+		return "draft"
+	}
+	if len(f.BaseBranches) > 0 {
+		base := pr.GetBase().GetRef()
+		ok := false
+		for _, g := range f.BaseBranches {
+			if g.Match(base) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return "base-branch"
+		}
+	}
+	user := pr.GetUser()
+	if f.ExcludeBots && strings.EqualFold(user.GetType(), "Bot") {
+		return "bot-author"
+	}
+	login := user.GetLogin()
+	for _, g := range f.LoginPatterns {
+		if g.Match(login) {
+			return "login:" + g.Pattern
+		}
+	}
+	for _, want := range f.Labels {
+		for _, l := range pr.Labels {
+			if strings.EqualFold(l.GetName(), want) {
+				return "label:" + want
+			}
+		}
+	}
+	head := pr.GetHead().GetRef()
+	for _, g := range f.HeadBranches {
+		if g.Match(head) {
+			return "head:" + g.Pattern
+		}
+	}
+	title := pr.GetTitle()
+	for _, re := range f.TitlePatterns {
+		if re.MatchString(title) {
+			return "title:" + re.String()
+		}
+	}
+	return ""
+}
+
+// Describe lists the active filters in a short human-readable form for report headers.
+func (f *PRFilter) Describe() []string {
+	if f == nil {
+		return nil
+	}
+	var out []string
+	if f.MergedOnly {
+		out = append(out, "merged only")
+	}
+	if f.ExcludeClosedUnmerged {
+		out = append(out, "no closed-unmerged")
+	}
+	if f.ExcludeDrafts {
+		out = append(out, "no drafts")
+	}
+	if len(f.BaseBranches) > 0 {
+		out = append(out, fmt.Sprintf("base in [%s]", strings.Join(patterns(f.BaseBranches), ", ")))
+	}
+	if f.ExcludeBots {
+		out = append(out, "no bots")
+	}
+	for _, g := range f.LoginPatterns {
+		out = append(out, "login!="+g.Pattern)
+	}
+	for _, l := range f.Labels {
+		out = append(out, "label!="+l)
+	}
+	for _, g := range f.HeadBranches {
+		out = append(out, "head!="+g.Pattern)
+	}
+	for _, re := range f.TitlePatterns {
+		out = append(out, "title!~"+re.String())
+	}
+	return out
+}
+
+// Glob is a pattern where * matches any run of characters and ? matches one character, compiled
+// once by Globs. Unlike path.Match, brackets are literal so "*[bot]" works as expected. The zero
+// Glob matches nothing.
+type Glob struct {
+	Pattern string
+	re      *regexp.Regexp
+}
+
+// Globs compiles patterns, ignoring case when foldCase is set.
+func Globs(patterns []string, foldCase bool) []Glob {
+	var out []Glob
+	for _, p := range patterns {
+		out = append(out, Glob{Pattern: p, re: compileGlob(p, foldCase)})
+	}
+	return out
+}
+
+// Match reports whether s matches the whole pattern.
+func (g Glob) Match(s string) bool { return g.re != nil && g.re.MatchString(s) }
+
+func patterns(globs []Glob) []string {
+	out := make([]string, 0, len(globs))
+	for _, g := range globs {
+		out = append(out, g.Pattern)
+	}
+	return out
+}
+
+// compileGlob translates pattern into an anchored regexp; every other character is quoted, so
+// it always compiles.
+func compileGlob(pattern string, foldCase bool) *regexp.Regexp {
+	var b strings.Builder
+	if foldCase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// RepoFilter selects which repositories are analyzed. Empty include lists match everything.
+type RepoFilter struct {
+	ExcludeArchived bool
+	ExcludeForks    bool
+	IncludeNames    []Glob   // repo name globs
+	ExcludeNames    []Glob   // repo name globs
+	IncludeTopics   []string // keep repos having at least one of these topics
+	ExcludeTopics   []string // drop repos having any of these topics
+	Visibilities    []string // public, private, internal
+	Languages       []string // primary language, case-insensitive
+}
+
+// Match returns the reason repo is excluded, or "" if it is selected.
+func (f *RepoFilter) Match(repo *github.Repository) string {
+	if f == nil || repo == nil {
+		return ""
+	}
+	name := repo.GetName()
+	if f.ExcludeArchived && repo.GetArchived() {
+		return "archived"
+	}
+	if f.ExcludeForks && repo.GetFork() {
+		return "fork"
+	}
+	if len(f.IncludeNames) > 0 && !anyGlob(f.IncludeNames, name) {
+		return "name not in --include-repo"
+	}
+	for _, g := range f.ExcludeNames {
+		if g.Match(name) {
+			return "name matches --exclude-repo " + g.Pattern
+		}
+	}
+	if len(f.IncludeTopics) > 0 && !hasAnyFold(repo.Topics, f.IncludeTopics) {
+		return "no topic in --include-topic"
+	}
+	for _, t := range f.ExcludeTopics {
+		if hasAnyFold(repo.Topics, []string{t}) {
+			return "topic " + t
+		}
+	}
+	if len(f.Visibilities) > 0 {
+		vis := repo.GetVisibility()
+		if vis == "" {
+			vis = "public"
+			if repo.GetPrivate() {
+				vis = "private"
+			}
+		}
+		if !hasAnyFold([]string{vis}, f.Visibilities) {
+			return "visibility " + vis
+		}
+	}
+	if len(f.Languages) > 0 && !hasAnyFold([]string{repo.GetLanguage()}, f.Languages) {
+		lang := repo.GetLanguage()
+		if lang == "" {
+			lang = "none"
+		}
+		return "language " + lang
+	}
+	return ""
+}
+
+// Describe lists the active repo selection filters in a short human-readable form.
+func (f *RepoFilter) Describe() []string {
+	if f == nil {
+		return nil
+	}
+	var out []string
+	if f.ExcludeArchived {
+		out = append(out, "no archived")
+	}
+	if f.ExcludeForks {
+		out = append(out, "no forks")
+	}
+	if len(f.IncludeNames) > 0 {
+		out = append(out, fmt.Sprintf("repo in [%s]", strings.Join(patterns(f.IncludeNames), ", ")))
+	}
+	for _, g := range f.ExcludeNames {
+		out = append(out, "repo!="+g.Pattern)
+	}
+	if len(f.IncludeTopics) > 0 {
+		out = append(out, fmt.Sprintf("topic in [%s]", strings.Join(f.IncludeTopics, ", ")))
+	}
+	for _, t := range f.ExcludeTopics {
+		out = append(out, "topic!="+t)
+	}
+	if len(f.Visibilities) > 0 {
+		out = append(out, fmt.Sprintf("visibility in [%s]", strings.Join(f.Visibilities, ", ")))
+	}
+	if len(f.Languages) > 0 {
+		out = append(out, fmt.Sprintf("language in [%s]", strings.Join(f.Languages, ", ")))
+	}
+	return out
+}
+
+func anyGlob(globs []Glob, s string) bool {
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyFold reports whether any element of have equals any element of want, case-insensitively.
+func hasAnyFold(have, want []string) bool {
+	for _, h := range have {
+		for _, w := range want {
+			if strings.EqualFold(h, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"regexp"
+	"testing"
+
+	github "github.com/google/go-github/v61/github"
+)
+
+func TestGlobs(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		foldCase bool
+		s        string
+		want     bool
+	}{
+		{"main", false, "main", true},
+		{"main", false, "maintenance", false},
+		{"release/*", false, "release/1.2", true},
+		{"release/*", false, "hotfix/release/1", false},
+		{"v?", false, "v1", true},
+		{"v?", false, "v10", false},
+		{"*[bot]", false, "dependabot[bot]", true},
+		{"*[bot]", false, "botb", false},
+		{"a.b", false, "axb", false},
+		{"Renovate*", false, "renovate-bot", false},
+		{"Renovate*", true, "renovate-bot", true},
+	}
+	for _, tt := range tests {
+		g := Globs([]string{tt.pattern}, tt.foldCase)[0]
+		if got := g.Match(tt.s); got != tt.want {
+			t.Errorf("Glob(%q, fold=%v).Match(%q) = %v, want %v", tt.pattern, tt.foldCase, tt.s, got, tt.want)
+		}
+	}
+	if (Glob{Pattern: "*"}).Match("x") {
+		t.Error("zero Glob matched")
+	}
+}
+
+func TestPRFilterMatch(t *testing.T) {
+	f := &PRFilter{
+		BaseBranches:  Globs([]string{"main", "release/*"}, false),
+		ExcludeBots:   true,
+		LoginPatterns: Globs([]string{"release-bot*"}, true),
+		Labels:        []string{"skip-review"},
+		HeadBranches:  Globs([]string{"renovate/*"}, false),
+		TitlePatterns: []*regexp.Regexp{regexp.MustCompile(`^chore\(deps\)`)},
+	}
+	pr := func(base, login, userType, head, title string, labels ...string) *github.PullRequest {
+		p := &github.PullRequest{
+			Base:  &github.PullRequestBranch{Ref: github.String(base)},
+			Head:  &github.PullRequestBranch{Ref: github.String(head)},
+			User:  &github.User{Login: github.String(login), Type: github.String(userType)},
+			Title: github.String(title),
+		}
+		for _, l := range labels {
+			p.Labels = append(p.Labels, &github.Label{Name: github.String(l)})
+		}
+		return p
+	}
+	tests := []struct {
+		pr   *github.PullRequest
+		want string
+	}{
+		{pr("main", "ann", "User", "feature", "Add thing"), ""},
+		{pr("release/2.0", "ann", "User", "feature", "Backport"), ""},
+		{pr("develop", "ann", "User", "feature", "Add thing"), "base-branch"},
+		{pr("main", "dependabot[bot]", "Bot", "deps", "Bump"), "bot-author"},
+		{pr("main", "Release-Bot-2", "User", "feature", "Release"), "login:release-bot*"},
+		{pr("main", "ann", "User", "feature", "Add thing", "Skip-Review"), "label:skip-review"},
+		{pr("main", "ann", "User", "renovate/go", "Update go"), "head:renovate/*"},
+		{pr("main", "ann", "User", "feature", "chore(deps): bump"), `title:^chore\(deps\)`},
+	}
+	for _, tt := range tests {
+		if got := f.Match(tt.pr); got != tt.want {
+			t.Errorf("Match(base=%s login=%s head=%s title=%q) = %q, want %q", tt.pr.GetBase().GetRef(), tt.pr.GetUser().GetLogin(), tt.pr.GetHead().GetRef(), tt.pr.GetTitle(), got, tt.want)
+		}
+	}
+}
+
+func TestRepoFilterNames(t *testing.T) {
+	f := &RepoFilter{IncludeNames: Globs([]string{"svc-*"}, false), ExcludeNames: Globs([]string{"*-legacy"}, false)}
+	for name, want := range map[string]string{
+		"svc-api":    "",
+		"svc-legacy": "name matches --exclude-repo *-legacy",
+		"tools":      "name not in --include-repo",
+	} {
+		if got := f.Match(&github.Repository{Name: github.String(name)}); got != want {
+			t.Errorf("Match(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
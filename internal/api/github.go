@@ -2,12 +2,17 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	github "github.com/google/go-github/v61/github"
 	"golang.org/x/oauth2"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	httpcache "pr-agent-cost-estimator/internal/httpcache"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,9 +25,12 @@ type Policy struct {
 	SleepMin         time.Duration // Min jitter between API calls
 	SleepMax         time.Duration // Max jitter between API calls
 	RetriesNonRate   int           // Retries for transient non-rate-limit errors
+	Throttle         bool          // Spread calls evenly over the remaining rate-limit window
+	ReserveFraction  float64       // Fraction of the hourly quota left untouched for other tools (0..1)
 }
 
-var policy = Policy{
+// DefaultPolicy is used by collectors that are not given an explicit policy.
+var DefaultPolicy = Policy{
 	EventualComplete: false,
 	MaxWaitReset:     2 * time.Minute,
 	SleepMin:         0,
@@ -30,15 +38,63 @@ var policy = Policy{
 	RetriesNonRate:   1,
 }
 
-// SetPolicy sets the global API policy.
-func SetPolicy(p Policy) { policy = p }
+// Collector crawls GitHub with its own client, policy, clock and sleeper, so several
+// differently-configured collectors can run in one process and waits can be faked in tests.
+type Collector struct {
+	client *github.Client
+	policy Policy
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
 
-func sleepJitter() {
-	if policy.SleepMax <= 0 {
+	mu       sync.Mutex
+	stats    CallStats
+	lastCall time.Time // time of the latest observed API call, for pacing
+}
+
+// NewCollector returns a collector using the real clock and a context-aware sleep.
+func NewCollector(client *github.Client, p Policy) *Collector {
+	return &Collector{
+		client: client,
+		policy: p,
+		now:    time.Now,
+		sleep:  sleepCtx,
+		stats:  CallStats{RateRemaining: -1},
+	}
+}
+
+// WithClock replaces the collector's clock and sleeper (e.g. with fakes in tests) and returns it.
+func (c *Collector) WithClock(now func() time.Time, sleep func(ctx context.Context, d time.Duration) error) *Collector {
+	c.now = now
+	c.sleep = sleep
+	return c
+}
+
+// Policy returns the collector's API policy.
+func (c *Collector) Policy() Policy { return c.policy }
+
+// sleepCtx sleeps for d or until ctx is done, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// sleepJitter pauses between API calls. Cancellation is not reported here; the next API call
+// fails with the context error instead.
+func (c *Collector) sleepJitter(ctx context.Context) {
+	if c.policy.SleepMax <= 0 {
 		return
 	}
-	min := policy.SleepMin
-	max := policy.SleepMax
+	min := c.policy.SleepMin
+	max := c.policy.SleepMax
 	if max < min {
 		max = min
 	}
@@ -47,16 +103,29 @@ func sleepJitter() {
 	if delta > 0 {
 		extra = time.Duration(rand.Int63n(int64(delta)))
 	}
-	time.Sleep(min + extra)
+	_ = c.sleep(ctx, min+extra)
 }
 
 // NewGitHubClient creates an authenticated GitHub client if token is provided; otherwise unauthenticated.
-func NewGitHubClient(ctx context.Context, token string) *github.Client {
+// base, if not nil, is the transport under authentication (e.g. an httpcache.Transport).
+func NewGitHubClient(ctx context.Context, token string, base http.RoundTripper) *github.Client {
+	if token == "" {
+		return NewGitHubClientWithTokenSource(ctx, nil, base)
+	}
+	// Use OAuth2 transport with static token
+	return NewGitHubClientWithTokenSource(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), base)
+}
+
+// NewGitHubClientWithTokenSource creates a GitHub client authenticated by ts (e.g. refreshing
+// GitHub App installation tokens); nil ts yields an unauthenticated client. base, if not nil,
+// is the transport under authentication (e.g. an httpcache.Transport).
+func NewGitHubClientWithTokenSource(ctx context.Context, ts oauth2.TokenSource, base http.RoundTripper) *github.Client {
 	var httpClient *http.Client
-	if token != "" {
-		// Use OAuth2 transport with static token
-		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-		httpClient = oauth2.NewClient(ctx, ts)
+	if base != nil {
+		httpClient = &http.Client{Transport: base}
+	}
+	if ts != nil {
+		httpClient = &http.Client{Transport: &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, ts), Base: base}}
 	}
 	client := github.NewClient(httpClient)
 	client.UserAgent = userAgent
@@ -64,13 +133,15 @@ func NewGitHubClient(ctx context.Context, token string) *github.Client {
 }
 
 // ListAllRepos lists all repositories for the given org with Type=all, handling pagination.
-func ListAllRepos(ctx context.Context, client *github.Client, org string) ([]*github.Repository, error) {
+func (c *Collector) ListAllRepos(ctx context.Context, org string) ([]*github.Repository, error) {
 	opt := &github.RepositoryListByOrgOptions{Type: "all", ListOptions: github.ListOptions{PerPage: 100}}
 	var all []*github.Repository
 	for {
-		repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
+		c.pace(ctx)
+		repos, resp, err := c.client.Repositories.ListByOrg(ctx, org, opt)
+		c.observe(resp)
 		if err != nil {
-			if resp != nil && waitIfRateLimited(resp) {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "org", org, "page", opt.Page) {
 				// retry same page after waiting
 				continue
 			}
@@ -81,15 +152,41 @@ func ListAllRepos(ctx context.Context, client *github.Client, org string) ([]*gi
 			break
 		}
 		opt.Page = resp.NextPage
-		sleepJitter()
+		c.sleepJitter(ctx)
 	}
 	return all, nil
 }
 
+// GetRepos fetches repository metadata for explicit "owner/name" entries, in input order.
+func (c *Collector) GetRepos(ctx context.Context, fullNames []string) ([]*github.Repository, error) {
+	var out []*github.Repository
+	for _, full := range fullNames {
+		owner, name, ok := strings.Cut(full, "/")
+		if !ok || owner == "" || name == "" {
+			return nil, fmt.Errorf("invalid repository %q, expected owner/name", full)
+		}
+		for {
+			c.pace(ctx)
+			repo, resp, err := c.client.Repositories.Get(ctx, owner, name)
+			c.observe(resp)
+			if err != nil {
+				if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", full) {
+					continue
+				}
+				return nil, fmt.Errorf("get %s: %w", full, err)
+			}
+			out = append(out, repo)
+			break
+		}
+		c.sleepJitter(ctx)
+	}
+	return out, nil
+}
+
 // CountPRsAndDateRange enumerates all PRs for a repo (state=all) with pagination and optional since/until
 // filtering on PR creation time. It returns the count of PRs within the window and the earliest and latest
 // createdAt timestamps observed (zero values if none).
-func CountPRsAndDateRange(ctx context.Context, client *github.Client, owner, repo string, since, until *time.Time) (int, time.Time, time.Time, error) {
+func (c *Collector) CountPRsAndDateRange(ctx context.Context, owner, repo string, since, until *time.Time) (int, time.Time, time.Time, error) {
 	opt := &github.PullRequestListOptions{
 		State:       "all",
 		Sort:        "created",
@@ -100,9 +197,11 @@ func CountPRsAndDateRange(ctx context.Context, client *github.Client, owner, rep
 	var first time.Time
 	var last time.Time
 	for {
-		prs, resp, err := client.PullRequests.List(ctx, owner, repo, opt)
+		c.pace(ctx)
+		prs, resp, err := c.client.PullRequests.List(ctx, owner, repo, opt)
+		c.observe(resp)
 		if err != nil {
-			if resp != nil && waitIfRateLimited(resp) {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", owner+"/"+repo, "page", opt.Page) {
 				// retry same page after waiting
 				continue
 			}
@@ -131,35 +230,85 @@ func CountPRsAndDateRange(ctx context.Context, client *github.Client, owner, rep
 			break
 		}
 		opt.Page = resp.NextPage
-		sleepJitter()
+		c.sleepJitter(ctx)
 	}
 	return count, first, last, nil
 }
 
+// AuthorStats accumulates per-author PR volume within a repository.
+type AuthorStats struct {
+	PRs       int
+	DiffChars int64
+}
+
+// RepoStats is the result of RepoPRDiffStats for a single repository.
+type RepoStats struct {
+	PRCount   int
+	DiffChars int64
+	First     time.Time
+	Last      time.Time
+	ByAuthor  map[string]*AuthorStats    // keyed by PR author login
+	Excluded  map[string]*ExclusionStats // keyed by PRFilter rule name
+
+	// Counted PRs whose diff is missing from DiffChars
+	DiffsSkipped int // 403/404/410/451: no access or gone
+	DiffsFailed  int // transient errors that persisted after retries
+
+	// Set by RepoPRLineStats: DiffChars is modeled from line stats rather than measured
+	Calibration *Calibration
+
+	// Every PR in the window, counted or excluded, in listing order; see StatsFromRecords
+	PRs []PRRecord
+}
+
+// addAuthor records one PR and its diff size under the given author login.
+func (s *RepoStats) addAuthor(login string, diffChars int64) {
+	if login == "" {
+		login = UnknownAuthor
+	}
+	a, ok := s.ByAuthor[login]
+	if !ok {
+		a = &AuthorStats{}
+		s.ByAuthor[login] = a
+	}
+	a.PRs++
+	a.DiffChars += diffChars
+}
+
+// UnknownAuthor is used for PRs whose author could not be determined (e.g. deleted accounts).
+const UnknownAuthor = "(unknown)"
+
 // RepoPRDiffStats lists PRs (state=all) for a repo within an optional createdAt window and
 // fetches the raw diff for each PR to compute the total diff character count.
-// It returns (prCount, totalDiffChars, firstCreated, lastCreated).
-func RepoPRDiffStats(ctx context.Context, client *github.Client, owner, repo string, since, until *time.Time, sampleBudget *int64, sampleBuf *strings.Builder) (int, int64, time.Time, time.Time, error) {
+// Counts are also broken down by PR author. PRs matched by filter are counted per rule in
+// Excluded and their diffs are not fetched unless filter.MeasureExcluded is set.
+// If ctx is cancelled, the stats collected so far are returned together with ctx.Err().
+func (c *Collector) RepoPRDiffStats(ctx context.Context, owner, repo string, since, until *time.Time, filter *PRFilter, sampleBudget *int64, sampleBuf *strings.Builder) (*RepoStats, error) {
 	opt := &github.PullRequestListOptions{
 		State:       "all",
 		Sort:        "created",
 		Direction:   "asc",
 		ListOptions: github.ListOptions{PerPage: 100},
 	}
-	count := 0
-	var total int64
-	var first time.Time
-	var last time.Time
+	stats := &RepoStats{ByAuthor: map[string]*AuthorStats{}, Excluded: map[string]*ExclusionStats{}}
 	for {
-		prs, resp, err := client.PullRequests.List(ctx, owner, repo, opt)
+		c.pace(ctx)
+		prs, resp, err := c.client.PullRequests.List(ctx, owner, repo, opt)
+		c.observe(resp)
 		if err != nil {
-			if resp != nil && waitIfRateLimited(resp) {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", owner+"/"+repo, "page", opt.Page) {
 				// retry same page after waiting
 				continue
 			}
-			return 0, 0, time.Time{}, time.Time{}, err
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+			return nil, err
 		}
 		for _, pr := range prs {
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
 			created := pr.GetCreatedAt().Time
 			if created.IsZero() {
 				continue
@@ -170,57 +319,58 @@ func RepoPRDiffStats(ctx context.Context, client *github.Client, owner, repo str
 			if until != nil && created.After(*until) {
 				continue
 			}
-			count++
-			if first.IsZero() || created.Before(first) {
-				first = created
+			c.recordPRProcessed()
+			// Diffs of closed PRs do not change, so a cache may serve them without revalidating
+			dctx := ctx
+			if pr.GetState() == "closed" {
+				dctx = httpcache.WithImmutable(ctx)
 			}
-			if last.IsZero() || created.After(last) {
-				last = created
+			if rule := filter.Match(pr); rule != "" {
+				rec := PRRecord{Number: pr.GetNumber(), Author: pr.GetUser().GetLogin(), CreatedAt: created, Excluded: rule}
+				if filter.MeasureExcluded {
+					diff, outcome := c.fetchPRDiff(dctx, owner, repo, pr.GetNumber())
+					if outcome == diffCancelled {
+						return stats, ctx.Err()
+					}
+					rec.DiffChars = int64(len(diff))
+					c.sleepJitter(ctx)
+				}
+				ex, ok := stats.Excluded[rule]
+				if !ok {
+					ex = &ExclusionStats{}
+					stats.Excluded[rule] = ex
+				}
+				ex.PRs++
+				ex.DiffChars += rec.DiffChars
+				stats.PRs = append(stats.PRs, rec)
+				continue
 			}
 
-			// Fetch raw diff for the PR and sum its length in characters (graceful on errors)
-			var diff string
-			var rresp *github.Response
-			var derr error
-			// policy-based retries for non-rate-limit errors
-			attempts := policy.RetriesNonRate
-			if attempts < 1 {
-				attempts = 1
+			diff, outcome := c.fetchPRDiff(dctx, owner, repo, pr.GetNumber())
+			if outcome == diffCancelled {
+				// Interrupted, not failed: the PR stays out of the partial stats
+				return stats, ctx.Err()
 			}
-			backoff := 1 * time.Second
-			for {
-				diff, rresp, derr = client.PullRequests.GetRaw(ctx, owner, repo, pr.GetNumber(), github.RawOptions{Type: github.Diff})
-				if derr == nil {
-					break
-				}
-				if rresp != nil && waitIfRateLimited(rresp) {
-					// rate limit: wait according to policy and retry (no attempt decrement)
-					continue
-				}
-				if isSkippableClientError(rresp) {
-					// permission/visibility/etc.: skip this PR diff
-					derr = nil
-					diff = ""
-					break
-				}
-				attempts--
-				if attempts <= 0 || ctx.Err() != nil {
-					// give up on this PR, skip
-					diff = ""
-					derr = nil
-					break
-				}
-				time.Sleep(backoff)
-				if backoff < 2*time.Minute {
-					backoff *= 2
-				}
+			stats.PRCount++
+			if stats.First.IsZero() || created.Before(stats.First) {
+				stats.First = created
 			}
-			if derr != nil {
-				// still failing after retries, skip PR
-				continue
+			if stats.Last.IsZero() || created.After(stats.Last) {
+				stats.Last = created
 			}
 			l := int64(len(diff))
-			total += l
+			rec := PRRecord{Number: pr.GetNumber(), Author: pr.GetUser().GetLogin(), CreatedAt: created, DiffChars: l}
+			switch outcome {
+			case diffSkipped:
+				stats.DiffsSkipped++
+				rec.Diff = DiffSkipped
+			case diffFailed:
+				stats.DiffsFailed++
+				rec.Diff = DiffFailed
+			}
+			stats.DiffChars += l
+			stats.addAuthor(pr.GetUser().GetLogin(), l)
+			stats.PRs = append(stats.PRs, rec)
 
 			// Optionally collect a bounded sample of diff text for tokenization ratio calculation
 			if sampleBudget != nil && sampleBuf != nil {
@@ -240,41 +390,111 @@ func RepoPRDiffStats(ctx context.Context, client *github.Client, owner, repo str
 					}
 				}
 			}
-			sleepJitter()
+			c.sleepJitter(ctx)
 		}
 		if resp.NextPage == 0 {
 			break
 		}
 		opt.Page = resp.NextPage
-		sleepJitter()
+		c.sleepJitter(ctx)
+	}
+	return stats, nil
+}
+
+// diffOutcome tells whether fetchPRDiff returned a real diff or gave up.
+type diffOutcome int
+
+const (
+	diffOK        diffOutcome = iota
+	diffSkipped               // skippable client error (permissions, gone, legal)
+	diffFailed                // retries exhausted
+	diffCancelled             // ctx was cancelled; the PR was not measured and must not be counted
+)
+
+// fetchPRDiff fetches the raw diff for a PR (graceful on errors). Rate limits are waited out per
+// policy; skippable client errors and exhausted retries yield an empty diff and a non-OK outcome.
+// Cancellation, including during a backoff or rate-limit wait, yields diffCancelled.
+func (c *Collector) fetchPRDiff(ctx context.Context, owner, repo string, number int) (string, diffOutcome) {
+	// policy-based retries for non-rate-limit errors
+	attempts := c.policy.RetriesNonRate
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := 1 * time.Second
+	for attempt := 1; ; attempt++ {
+		c.pace(ctx)
+		diff, rresp, derr := c.client.PullRequests.GetRaw(ctx, owner, repo, number, github.RawOptions{Type: github.Diff})
+		c.observe(rresp)
+		if derr == nil {
+			return diff, diffOK
+		}
+		status := 0
+		if rresp != nil && rresp.Response != nil {
+			status = rresp.Response.StatusCode
+		}
+		if rresp != nil && c.waitIfRateLimited(ctx, rresp, derr, "repo", owner+"/"+repo, "pr", number, "attempt", attempt) {
+			// rate limit: wait according to policy and retry (no attempt decrement)
+			continue
+		}
+		if isSkippableClientError(rresp) {
+			// permission/visibility/etc.: skip this PR diff
+			slog.Debug("skipping PR diff", "repo", owner+"/"+repo, "pr", number, "status", status, "err", derr)
+			return "", diffSkipped
+		}
+		if ctx.Err() != nil {
+			return "", diffCancelled
+		}
+		attempts--
+		if attempts <= 0 {
+			// give up on this PR, skip
+			slog.Warn("PR diff failed after retries", "repo", owner+"/"+repo, "pr", number, "status", status, "attempt", attempt, "err", derr)
+			return "", diffFailed
+		}
+		slog.Info("retrying PR diff", "repo", owner+"/"+repo, "pr", number, "status", status, "attempt", attempt, "wait", backoff, "err", derr)
+		if err := c.sleep(ctx, backoff); err != nil {
+			return "", diffCancelled
+		}
+		if backoff < 2*time.Minute {
+			backoff *= 2
+		}
 	}
-	return count, total, first, last, nil
 }
 
 // waitIfRateLimited sleeps for the duration indicated by Retry-After header or Rate.Reset.
-// Returns true if it waited and the caller should retry; false otherwise.
-func waitIfRateLimited(resp *github.Response) bool {
+// Secondary (abuse) rate limits are recognized from err; without a Retry-After header they wait
+// one minute as GitHub recommends.
+// Returns true if it waited and the caller should retry; false otherwise, including when ctx
+// was cancelled during the wait.
+// attrs are slog key/value pairs (repo, pr, ...) identifying the request for the wait log line.
+func (c *Collector) waitIfRateLimited(ctx context.Context, resp *github.Response, err error, attrs ...any) bool {
 	if resp == nil || resp.Response == nil {
 		return false
 	}
-	if !isRateLimitResponse(resp) {
+	var abuse *github.AbuseRateLimitError
+	secondary := errors.As(err, &abuse)
+	if !secondary && !isRateLimitResponse(resp) {
 		return false
 	}
+	attrs = append(attrs, "status", resp.Response.StatusCode, "secondary", secondary)
 	// Prefer Retry-After seconds if present
 	if v := resp.Response.Header.Get("Retry-After"); v != "" {
 		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
-			waitWithCap(time.Duration(secs) * time.Second)
-			return true
+			return c.waitWithCap(ctx, time.Duration(secs)*time.Second, append(attrs, "source", "retry-after")...) == nil
+		}
+	}
+	if secondary {
+		if abuse.RetryAfter != nil && *abuse.RetryAfter > 0 {
+			return c.waitWithCap(ctx, *abuse.RetryAfter, append(attrs, "source", "retry-after")...) == nil
 		}
+		return c.waitWithCap(ctx, time.Minute, append(attrs, "source", "secondary-default")...) == nil
 	}
 	// Fallback to Rate.Reset time
 	if !resp.Rate.Reset.Time.IsZero() {
-		wait := time.Until(resp.Rate.Reset.Time)
+		wait := resp.Rate.Reset.Time.Sub(c.now())
 		if wait <= 0 {
 			wait = 5 * time.Second
 		}
-		waitWithCap(wait)
-		return true
+		return c.waitWithCap(ctx, wait, append(attrs, "source", "rate-reset", "reset", resp.Rate.Reset.Time)...) == nil
 	}
 	return false
 }
@@ -289,24 +509,33 @@ func isRateLimitResponse(resp *github.Response) bool {
 		return true
 	}
 	if code == 403 {
-		// Only treat as rate limit if remaining is 0
-		return resp.Response.Header.Get("X-RateLimit-Remaining") == "0"
+		// Only treat as rate limit if remaining is 0 or a secondary limit sent Retry-After
+		return resp.Response.Header.Get("X-RateLimit-Remaining") == "0" || resp.Response.Header.Get("Retry-After") != ""
 	}
 	return false
 }
 
-func waitWithCap(wait time.Duration) {
-	capDur := policy.MaxWaitReset
-	if !policy.EventualComplete {
+func (c *Collector) waitWithCap(ctx context.Context, wait time.Duration, attrs ...any) error {
+	capDur := c.policy.MaxWaitReset
+	if !c.policy.EventualComplete {
 		// For non-eventual mode, default to 2m cap if none provided
 		if capDur == 0 {
 			capDur = 2 * time.Minute
 		}
 	}
+	requested := wait
 	if capDur > 0 && wait > capDur {
 		wait = capDur
 	}
-	time.Sleep(wait)
+	slog.Warn("rate limited, waiting", append(attrs, "wait", wait, "requested_wait", requested)...)
+	start := c.now()
+	err := c.sleep(ctx, wait)
+	if err != nil {
+		c.recordRateLimitSleep(c.now().Sub(start))
+		return err
+	}
+	c.recordRateLimitSleep(wait)
+	return nil
 }
 
 // isSkippableClientError returns true for client-side errors we want to skip per-PR.
@@ -325,3 +554,19 @@ func isSkippableClientError(resp *github.Response) bool {
 		return false
 	}
 }
+
+// IsAuthError reports whether err is GitHub rejecting the credentials: a 401 (bad or expired
+// token) or a 403 asking for SAML SSO authorization of the token.
+func IsAuthError(err error) bool {
+	var er *github.ErrorResponse
+	if !errors.As(err, &er) || er.Response == nil {
+		return false
+	}
+	switch er.Response.StatusCode {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		return strings.HasPrefix(er.Response.Header.Get("X-GitHub-SSO"), "required")
+	}
+	return false
+}
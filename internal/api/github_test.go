@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+	fakegithub "pr-agent-cost-estimator/internal/fakegithub"
+)
+
+// fakeClock is a collector clock whose sleeps advance time instantly and are recorded.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+	err    error // returned by sleep, e.g. to simulate cancellation
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	if c.err != nil {
+		return c.err
+	}
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// limitedServer answers the first request to /orgs/acme/repos with limited and every later one
+// with a single repository.
+func limitedServer(t *testing.T, limited func(w http.ResponseWriter)) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			limited(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"api","owner":{"login":"acme"}}]`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func testClient(t *testing.T, srv *httptest.Server) *github.Client {
+	t.Helper()
+	client := github.NewClient(nil)
+	u, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = u
+	return client
+}
+
+// TestRateLimitWaits checks how long the collector waits for each kind of rate-limit response
+// and that it retries afterwards. go-github refuses requests until a reset that is still in the
+// future by the real clock, so the fake clock runs an hour behind and resets fall in between.
+func TestRateLimitWaits(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	primary := func(after time.Duration) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(start.Add(after).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+		}
+	}
+	secondary := func(retryAfter string) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"You have exceeded a secondary rate limit","documentation_url":"https://docs.github.com/rest/overview/rate-limits-for-the-rest-api#about-secondary-rate-limits"}`))
+		}
+	}
+	tests := []struct {
+		name    string
+		policy  Policy
+		limited func(w http.ResponseWriter)
+		want    time.Duration
+	}{
+		{"primary reset", Policy{EventualComplete: true}, primary(90 * time.Second), 90 * time.Second},
+		{"primary reset already passed", Policy{EventualComplete: true}, primary(-time.Minute), 5 * time.Second},
+		{"primary reset capped by default", Policy{}, primary(10 * time.Minute), 2 * time.Minute},
+		{"primary reset capped by max wait", Policy{MaxWaitReset: 30 * time.Second}, primary(10 * time.Minute), 30 * time.Second},
+		{"primary reset uncapped when eventual", Policy{EventualComplete: true}, primary(10 * time.Minute), 10 * time.Minute},
+		{"eventual with explicit cap", Policy{EventualComplete: true, MaxWaitReset: 3 * time.Minute}, primary(10 * time.Minute), 3 * time.Minute},
+		{"retry-after on 429", Policy{}, func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, 7 * time.Second},
+		{"retry-after on 403", Policy{}, func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "12")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"slow down"}`))
+		}, 12 * time.Second},
+		{"secondary without retry-after", Policy{}, secondary(""), time.Minute},
+		{"retry-after capped", Policy{MaxWaitReset: 10 * time.Second}, func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "45")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := limitedServer(t, tt.limited)
+			clock := &fakeClock{now: start}
+			c := NewCollector(testClient(t, srv), tt.policy).WithClock(clock.Now, clock.Sleep)
+			repos, err := c.ListAllRepos(context.Background(), "acme")
+			if err != nil {
+				t.Fatalf("ListAllRepos: %v", err)
+			}
+			if len(repos) != 1 || *calls != 2 {
+				t.Errorf("repos = %d, calls = %d, want 1 repo after one retry", len(repos), *calls)
+			}
+			if len(clock.sleeps) != 1 || clock.sleeps[0] != tt.want {
+				t.Errorf("sleeps = %v, want [%s]", clock.sleeps, tt.want)
+			}
+			st := c.Snapshot()
+			if st.APICalls != 2 || st.RateLimitWaits != 1 || st.RateLimitSleep != tt.want {
+				t.Errorf("stats = %+v, want 2 calls and one %s wait", st, tt.want)
+			}
+		})
+	}
+}
+
+// TestRateLimitWaitCancelled checks that a wait interrupted by cancellation is not retried.
+func TestRateLimitWaitCancelled(t *testing.T) {
+	srv, calls := limitedServer(t, func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	clock := &fakeClock{now: time.Now(), err: context.Canceled}
+	c := NewCollector(testClient(t, srv), Policy{}).WithClock(clock.Now, clock.Sleep)
+	if _, err := c.ListAllRepos(context.Background(), "acme"); err == nil {
+		t.Fatal("ListAllRepos succeeded after a cancelled wait")
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want no retry", *calls)
+	}
+}
+
+// TestNotRateLimited checks that plain 403s and server errors are not waited on.
+func TestNotRateLimited(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusNotFound, http.StatusBadGateway} {
+		srv, calls := limitedServer(t, func(w http.ResponseWriter) {
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message":"nope"}`))
+		})
+		clock := &fakeClock{now: time.Now()}
+		c := NewCollector(testClient(t, srv), Policy{}).WithClock(clock.Now, clock.Sleep)
+		if _, err := c.ListAllRepos(context.Background(), "acme"); err == nil {
+			t.Errorf("%d: ListAllRepos succeeded", status)
+		}
+		if *calls != 1 || len(clock.sleeps) != 0 {
+			t.Errorf("%d: calls = %d, sleeps = %v, want one call and no wait", status, *calls, clock.sleeps)
+		}
+	}
+}
+
+// TestDiffRetryBackoff checks the diff fetch's exponential backoff for transient errors and that
+// skippable statuses are not retried.
+func TestDiffRetryBackoff(t *testing.T) {
+	// PR number → status and how many times it is served before the diff
+	failures := map[int]struct{ status, times int }{
+		1: {http.StatusBadGateway, 2},
+		2: {http.StatusBadGateway, 10},
+		3: {http.StatusNotFound, 10},
+		4: {http.StatusUnavailableForLegalReasons, 10},
+	}
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/repos/acme/api/pulls/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if f := failures[n]; f.times > 0 {
+			f.times--
+			failures[n] = f
+			w.WriteHeader(f.status)
+			return
+		}
+		w.Write([]byte("diff --git a/x b/x\n"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		number int
+		want   diffOutcome
+		sleeps []time.Duration
+	}{
+		{1, diffOK, []time.Duration{time.Second, 2 * time.Second}},
+		{2, diffFailed, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+		{3, diffSkipped, nil},
+		{4, diffSkipped, nil},
+	}
+	for _, tt := range tests {
+		clock := &fakeClock{now: time.Now()}
+		c := NewCollector(testClient(t, srv), Policy{RetriesNonRate: 4}).WithClock(clock.Now, clock.Sleep)
+		_, got := c.fetchPRDiff(context.Background(), "acme", "api", tt.number)
+		if got != tt.want {
+			t.Errorf("PR %d: outcome = %d, want %d", tt.number, got, tt.want)
+		}
+		if len(clock.sleeps) != len(tt.sleeps) {
+			t.Errorf("PR %d: sleeps = %v, want %v", tt.number, clock.sleeps, tt.sleeps)
+			continue
+		}
+		for i := range tt.sleeps {
+			if clock.sleeps[i] != tt.sleeps[i] {
+				t.Errorf("PR %d: sleeps = %v, want %v", tt.number, clock.sleeps, tt.sleeps)
+				break
+			}
+		}
+	}
+}
+
+// TestDiffCancelledDuringBackoff interrupts a crawl while it backs off before retrying a diff:
+// the PR is neither counted nor reported as a failed diff, and the crawl returns the context
+// error so the run ends as interrupted.
+func TestDiffCancelledDuringBackoff(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	srv := fakegithub.New(&fakegithub.Org{Login: "acme", Repos: []*fakegithub.Repo{{Name: "api", PRs: []*fakegithub.PR{
+		{Number: 1, Author: "ann", CreatedAt: created, MergedAt: created.Add(time.Hour), Diff: "+a\n"},
+		{Number: 2, Author: "bob", CreatedAt: created.Add(time.Hour), MergedAt: created.Add(2 * time.Hour), Diff: "+b\n", FailTimes: 100},
+	}}}})
+	defer srv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var sleeps []time.Duration
+	interrupt := func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		cancel() // SIGINT arrives during the backoff
+		return ctx.Err()
+	}
+	c := NewCollector(client, Policy{RetriesNonRate: 3}).WithClock(time.Now, interrupt)
+
+	stats, err := c.RepoPRDiffStats(ctx, "acme", "api", nil, nil, nil, nil, nil)
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if len(sleeps) != 1 || sleeps[0] != time.Second {
+		t.Errorf("sleeps = %v, want the first backoff only", sleeps)
+	}
+	if stats == nil || stats.PRCount != 1 || stats.DiffsFailed != 0 || len(stats.PRs) != 1 || stats.PRs[0].Number != 1 {
+		t.Fatalf("stats = %+v, want only PR 1 and no failed diffs", stats)
+	}
+	if _, got := c.fetchPRDiff(ctx, "acme", "api", 2); got != diffCancelled {
+		t.Errorf("outcome with a cancelled context = %d, want diffCancelled", got)
+	}
+}
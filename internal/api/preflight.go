@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	github "github.com/google/go-github/v61/github"
+)
+
+// PreflightFinding is a token or access problem that would make the report silently wrong,
+// e.g. private repositories missing from the listing or private diffs skipped as 403/404.
+type PreflightFinding struct {
+	Org     string // empty for token-wide findings
+	Check   string // token, scopes, sso, membership or private-repos
+	Message string
+}
+
+func (f PreflightFinding) String() string {
+	if f.Org == "" {
+		return fmt.Sprintf("[%s] %s", f.Check, f.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", f.Check, f.Org, f.Message)
+}
+
+// Preflight verifies that the token can see everything in orgs before crawling: classic PAT
+// scopes (X-OAuth-Scopes), SAML SSO authorization (X-GitHub-SSO), org membership, and the number
+// of private repositories in discovered versus the org's total_private_repos. Checks that do not
+// apply to the token type (GitHub App or fine-grained tokens have no scopes header or user) are
+// skipped. It costs about three API calls per org.
+func (c *Collector) Preflight(ctx context.Context, orgs []string, discovered []*github.Repository) []PreflightFinding {
+	var findings []PreflightFinding
+	add := func(org, check, format string, args ...any) {
+		findings = append(findings, PreflightFinding{Org: org, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	c.pace(ctx)
+	user, resp, err := c.client.Users.Get(ctx, "")
+	c.observe(resp)
+	login := ""
+	switch {
+	case err == nil:
+		login = user.GetLogin()
+		if scopes, ok := resp.Response.Header["X-Oauth-Scopes"]; ok {
+			// Only classic PATs and OAuth tokens send the header; fine-grained tokens omit it
+			have := strings.Split(strings.Join(scopes, ","), ",")
+			if !hasScope(have, "repo") {
+				add("", "scopes", "token scopes [%s] lack \"repo\": private repositories and their PR diffs are invisible", strings.Join(scopes, ","))
+			}
+		}
+	case resp != nil && resp.Response != nil && resp.Response.StatusCode == http.StatusUnauthorized:
+		add("", "token", "no valid token: only public repositories are visible (and the rate limit is 60/hour)")
+	case resp != nil && resp.Response != nil && resp.Response.StatusCode == http.StatusForbidden:
+		// GitHub App installation tokens cannot read /user; membership checks do not apply
+	default:
+		add("", "token", "could not verify the token: %v", err)
+	}
+
+	visiblePrivate := map[string]int{}
+	for _, r := range discovered {
+		if r.GetPrivate() {
+			visiblePrivate[strings.ToLower(repoOwnerLogin(r))]++
+		}
+	}
+	for _, org := range orgs {
+		c.pace(ctx)
+		o, resp, err := c.client.Organizations.Get(ctx, org)
+		c.observe(resp)
+		if sso := ssoHeader(resp); sso != "" {
+			add(org, "sso", "org enforces SAML SSO and the token is not authorized for it; authorize the token for SSO (%s)", sso)
+		}
+		if err != nil {
+			add(org, "private-repos", "could not read the organization: %v", err)
+			continue
+		}
+		if total := o.GetTotalPrivateRepos(); o.TotalPrivateRepos != nil && int64(visiblePrivate[strings.ToLower(org)]) < total {
+			add(org, "private-repos", "token sees %d of %d private repositories", visiblePrivate[strings.ToLower(org)], total)
+		}
+
+		if login == "" {
+			continue
+		}
+		c.pace(ctx)
+		m, resp, err := c.client.Organizations.GetOrgMembership(ctx, "", org)
+		c.observe(resp)
+		switch {
+		case err == nil && m.GetState() != "active":
+			add(org, "membership", "%s has a %s membership; private repositories are invisible until it is accepted", login, m.GetState())
+		case err != nil && resp != nil && resp.Response != nil && resp.Response.StatusCode == http.StatusNotFound:
+			add(org, "membership", "%s is not a member: only public repositories are visible", login)
+		}
+		// other errors (403 without read:org) leave the private repo count as the signal
+	}
+	return findings
+}
+
+// ssoHeader returns the X-GitHub-SSO header if it says authorization is required.
+func ssoHeader(resp *github.Response) string {
+	if resp == nil || resp.Response == nil {
+		return ""
+	}
+	v := resp.Response.Header.Get("X-GitHub-SSO")
+	if !strings.HasPrefix(v, "required") {
+		return ""
+	}
+	return v
+}
+
+// hasScope reports whether want is among the granted scopes.
+func hasScope(have []string, want string) bool {
+	for _, s := range have {
+		if strings.TrimSpace(s) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// repoOwnerLogin mirrors main's repoOwner: the owner login, or the full name's prefix.
+func repoOwnerLogin(r *github.Repository) string {
+	if owner := r.GetOwner().GetLogin(); owner != "" {
+		return owner
+	}
+	owner, _, _ := strings.Cut(r.GetFullName(), "/")
+	return owner
+}
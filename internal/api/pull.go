@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	github "github.com/google/go-github/v61/github"
+)
+
+// PullRequest fetches the metadata of one pull request, waiting out rate limits per policy.
+func (c *Collector) PullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, error) {
+	for {
+		c.pace(ctx)
+		pr, resp, err := c.client.PullRequests.Get(ctx, owner, repo, number)
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", owner+"/"+repo, "pr", number) {
+				continue
+			}
+			return nil, fmt.Errorf("get %s/%s#%d: %w", owner, repo, number, err)
+		}
+		return pr, nil
+	}
+}
+
+// PRDiff fetches the raw diff of one pull request with the same retries as a crawl. Unlike a
+// crawl, which counts and skips such PRs, a diff that cannot be fetched is an error.
+func (c *Collector) PRDiff(ctx context.Context, owner, repo string, number int) (string, error) {
+	diff, outcome := c.fetchPRDiff(ctx, owner, repo, number)
+	switch outcome {
+	case diffSkipped:
+		return "", fmt.Errorf("diff of %s/%s#%d is not accessible to this token", owner, repo, number)
+	case diffCancelled:
+		return "", ctx.Err()
+	case diffFailed:
+		return "", fmt.Errorf("diff of %s/%s#%d could not be fetched after retries", owner, repo, number)
+	}
+	return diff, nil
+}
+
+// Login returns the login of the authenticated user (GET /user). Installation tokens, including
+// the GITHUB_TOKEN of GitHub Actions, cannot call it and get a 403.
+func (c *Collector) Login(ctx context.Context) (string, error) {
+	for {
+		c.pace(ctx)
+		user, resp, err := c.client.Users.Get(ctx, "")
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err) {
+				continue
+			}
+			return "", fmt.Errorf("get authenticated user: %w", err)
+		}
+		return user.GetLogin(), nil
+	}
+}
+
+// UpsertComment keeps a single "sticky" comment on a pull request: the first issue comment
+// written by author and containing marker is replaced by body, or body is posted as a new
+// comment when there is none. Comments by anyone else are never edited, even if they quote the
+// marker. author is the login the client posts as; empty means the authenticated user (Login).
+// body should contain marker so the next run finds it again. It returns the comment and
+// whether it was created; an existing comment that already reads body is left untouched.
+func (c *Collector) UpsertComment(ctx context.Context, owner, repo string, number int, author, marker, body string) (*github.IssueComment, bool, error) {
+	if author == "" {
+		login, err := c.Login(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		author = login
+	}
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	var existing *github.IssueComment
+	for existing == nil {
+		c.pace(ctx)
+		comments, resp, err := c.client.Issues.ListComments(ctx, owner, repo, number, opt)
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", owner+"/"+repo, "pr", number, "page", opt.Page) {
+				continue
+			}
+			return nil, false, fmt.Errorf("list comments of %s/%s#%d: %w", owner, repo, number, err)
+		}
+		for _, cm := range comments {
+			if strings.EqualFold(cm.GetUser().GetLogin(), author) && strings.Contains(cm.GetBody(), marker) {
+				existing = cm
+				break
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	if existing != nil && existing.GetBody() == body {
+		return existing, false, nil
+	}
+	for {
+		c.pace(ctx)
+		var cm *github.IssueComment
+		var resp *github.Response
+		var err error
+		if existing != nil {
+			cm, resp, err = c.client.Issues.EditComment(ctx, owner, repo, existing.GetID(), &github.IssueComment{Body: &body})
+		} else {
+			cm, resp, err = c.client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+		}
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "repo", owner+"/"+repo, "pr", number) {
+				continue
+			}
+			return nil, false, fmt.Errorf("write comment on %s/%s#%d: %w", owner, repo, number, err)
+		}
+		return cm, existing == nil, nil
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+	fakegithub "pr-agent-cost-estimator/internal/fakegithub"
+)
+
+// TestUpsertComment checks that the sticky comment is created once, then edited in place, and
+// that a comment by someone else quoting the marker is never touched.
+func TestUpsertComment(t *testing.T) {
+	const marker = "<!-- sticky -->"
+	quoted := "Why does the bot write " + marker + " into its comments?"
+	created := time.Now().Add(-time.Hour)
+	srv := fakegithub.New(&fakegithub.Org{Login: "acme", Repos: []*fakegithub.Repo{{Name: "api", PRs: []*fakegithub.PR{{
+		Number: 7, Author: "dev", CreatedAt: created,
+		Comments: []*fakegithub.Comment{{ID: 40, Author: "reviewer", Body: quoted, CreatedAt: created, UpdatedAt: created}},
+	}}}}})
+	defer srv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	c := NewCollector(client, DefaultPolicy)
+	ctx := context.Background()
+
+	login, err := c.Login(ctx)
+	if err != nil || login != "fake-user" {
+		t.Fatalf("Login = %q, %v, want fake-user", login, err)
+	}
+
+	// The reviewer's comment contains the marker but is not ours: a new comment is posted
+	first, isNew, err := c.UpsertComment(ctx, "acme", "api", 7, "", marker, "v1 "+marker)
+	if err != nil || !isNew {
+		t.Fatalf("first upsert: created=%v, err=%v, want a new comment", isNew, err)
+	}
+	// Ours is edited in place; the author match ignores case
+	second, isNew, err := c.UpsertComment(ctx, "acme", "api", 7, "Fake-User", marker, "v2 "+marker)
+	if err != nil || isNew || second.GetID() != first.GetID() {
+		t.Fatalf("second upsert: id=%d created=%v err=%v, want comment %d updated", second.GetID(), isNew, err, first.GetID())
+	}
+	// Unchanged content is not rewritten
+	before := srv.Requests()
+	if _, isNew, err := c.UpsertComment(ctx, "acme", "api", 7, "fake-user", marker, "v2 "+marker); err != nil || isNew {
+		t.Fatalf("third upsert: created=%v, err=%v", isNew, err)
+	}
+	if n := srv.Requests() - before; n != 1 {
+		t.Errorf("unchanged upsert made %d requests, want only the comment listing", n)
+	}
+
+	comments := srv.Comments("acme", "api", 7)
+	if len(comments) != 2 {
+		t.Fatalf("comments = %+v, want the reviewer's and ours", comments)
+	}
+	if comments[0].Body != quoted || !comments[0].UpdatedAt.Equal(created) {
+		t.Errorf("reviewer's comment was changed: %+v", comments[0])
+	}
+	if comments[1].Author != "fake-user" || comments[1].Body != "v2 "+marker {
+		t.Errorf("our comment = %+v, want fake-user's v2", comments[1])
+	}
+
+	// Posting as another login (e.g. an app bot) leaves fake-user's comment alone too
+	if _, isNew, err := c.UpsertComment(ctx, "acme", "api", 7, "cost-bot[bot]", marker, "v3 "+marker); err != nil || !isNew {
+		t.Errorf("upsert as another author: created=%v, err=%v, want a new comment", isNew, err)
+	}
+	if got := srv.Comments("acme", "api", 7)[1].Body; !strings.HasPrefix(got, "v2 ") {
+		t.Errorf("fake-user's comment = %q, want it untouched", got)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import "time"
+
+// PRRecord is one pull request seen by a crawl. Crawls keep them in RepoStats.PRs so a stored
+// crawl can be re-aggregated later (see StatsFromRecords) without calling GitHub again.
+type PRRecord struct {
+	Number    int       `json:"number"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+	DiffChars int64     `json:"diffChars"`          // measured, or modeled in fast mode; 0 for unmeasured exclusions
+	Lines     int64     `json:"lines,omitempty"`    // fast mode: additions+deletions
+	Diff      string    `json:"diff,omitempty"`     // DiffSkipped or DiffFailed when the diff is missing
+	Excluded  string    `json:"excluded,omitempty"` // PRFilter rule that excluded the PR
+}
+
+// PRRecord.Diff values for counted PRs whose diff is missing from DiffChars.
+const (
+	DiffSkipped = "skipped" // 403/404/410/451
+	DiffFailed  = "failed"  // retries exhausted
+)
+
+// StatsFromRecords re-aggregates stored PR records into the RepoStats a crawl would have
+// returned, attaching cal for fast-mode crawls.
+func StatsFromRecords(prs []PRRecord, cal *Calibration) *RepoStats {
+	stats := &RepoStats{ByAuthor: map[string]*AuthorStats{}, Excluded: map[string]*ExclusionStats{}, Calibration: cal, PRs: prs}
+	for _, p := range prs {
+		if p.Excluded != "" {
+			ex, ok := stats.Excluded[p.Excluded]
+			if !ok {
+				ex = &ExclusionStats{}
+				stats.Excluded[p.Excluded] = ex
+			}
+			ex.PRs++
+			ex.DiffChars += p.DiffChars
+			continue
+		}
+		stats.PRCount++
+		if stats.First.IsZero() || p.CreatedAt.Before(stats.First) {
+			stats.First = p.CreatedAt
+		}
+		if stats.Last.IsZero() || p.CreatedAt.After(stats.Last) {
+			stats.Last = p.CreatedAt
+		}
+		switch p.Diff {
+		case DiffSkipped:
+			stats.DiffsSkipped++
+		case DiffFailed:
+			stats.DiffsFailed++
+		}
+		stats.DiffChars += p.DiffChars
+		stats.addAuthor(p.Author, p.DiffChars)
+	}
+	return stats
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+)
+
+// CallStats is a snapshot of a collector's API activity, used for progress reporting.
+type CallStats struct {
+	APICalls       int64         // HTTP requests sent to GitHub
+	PRsProcessed   int64         // PRs examined by RepoPRDiffStats (kept or excluded)
+	RateLimit      int           // X-RateLimit-Limit from the latest response (0 if unknown)
+	RateRemaining  int           // X-RateLimit-Remaining from the latest response (-1 if unknown)
+	RateReset      time.Time     // X-RateLimit-Reset from the latest response
+	RateLimitSleep time.Duration // total time spent waiting for rate limits to reset
+	RateLimitWaits int64         // number of rate-limit waits
+	ThrottleSleep  time.Duration // total time spent pacing calls (Policy.Throttle)
+}
+
+// Snapshot returns the collector's current API activity counters. Safe for concurrent use.
+func (c *Collector) Snapshot() CallStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Since returns the activity counted after prev, an earlier snapshot of the same collector.
+// The rate-limit fields are the current values, not differences.
+func (s CallStats) Since(prev CallStats) CallStats {
+	s.APICalls -= prev.APICalls
+	s.PRsProcessed -= prev.PRsProcessed
+	s.RateLimitSleep -= prev.RateLimitSleep
+	s.RateLimitWaits -= prev.RateLimitWaits
+	s.ThrottleSleep -= prev.ThrottleSleep
+	return s
+}
+
+// observe counts one API call and records the core rate-limit headers parsed by go-github.
+func (c *Collector) observe(resp *github.Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.APICalls++
+	c.lastCall = c.now()
+	if resp == nil || resp.Response == nil || resp.Rate.Limit == 0 {
+		return
+	}
+	if res := resp.Response.Header.Get("X-RateLimit-Resource"); res != "" && res != "core" {
+		return // search/graphql budgets are separate from the core budget used for pacing
+	}
+	c.stats.RateLimit = resp.Rate.Limit
+	c.stats.RateRemaining = resp.Rate.Remaining
+	c.stats.RateReset = resp.Rate.Reset.Time
+}
+
+func (c *Collector) recordPRProcessed() {
+	c.mu.Lock()
+	c.stats.PRsProcessed++
+	c.mu.Unlock()
+}
+
+func (c *Collector) recordRateLimitSleep(d time.Duration) {
+	c.mu.Lock()
+	c.stats.RateLimitSleep += d
+	c.stats.RateLimitWaits++
+	c.mu.Unlock()
+}
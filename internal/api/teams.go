@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	github "github.com/google/go-github/v61/github"
+)
+
+// OrgTeamMembership maps each member login to a single team slug using the GitHub Teams API.
+// Users in several teams are attributed to the first team in slug order so that team totals
+// add up to the org total.
+func (c *Collector) OrgTeamMembership(ctx context.Context, org string) (map[string]string, error) {
+	var teams []*github.Team
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		c.pace(ctx)
+		page, resp, err := c.client.Teams.ListTeams(ctx, org, opt)
+		c.observe(resp)
+		if err != nil {
+			if resp != nil && c.waitIfRateLimited(ctx, resp, err, "org", org, "page", opt.Page) {
+				continue
+			}
+			return nil, err
+		}
+		teams = append(teams, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+		c.sleepJitter(ctx)
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].GetSlug() < teams[j].GetSlug() })
+
+	members := map[string]string{}
+	for _, t := range teams {
+		slug := t.GetSlug()
+		mopt := &github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			c.pace(ctx)
+			users, resp, err := c.client.Teams.ListTeamMembersBySlug(ctx, org, slug, mopt)
+			c.observe(resp)
+			if err != nil {
+				if resp != nil && c.waitIfRateLimited(ctx, resp, err, "org", org, "team", slug, "page", mopt.Page) {
+					continue
+				}
+				if isSkippableClientError(resp) {
+					// secret teams or missing read:org scope: leave members unassigned
+					slog.Debug("skipping team members", "org", org, "team", slug, "status", resp.Response.StatusCode, "err", err)
+					break
+				}
+				return nil, err
+			}
+			for _, u := range users {
+				login := u.GetLogin()
+				if _, seen := members[login]; !seen && login != "" {
+					members[login] = slug
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			mopt.Page = resp.NextPage
+			c.sleepJitter(ctx)
+		}
+		c.sleepJitter(ctx)
+	}
+	return members, nil
+}
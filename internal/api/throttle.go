@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// pace runs before every API call when Policy.Throttle is set. Using the rate-limit headers of
+// the latest response, it spreads the remaining budget (minus the reserved fraction of the
+// hourly quota) evenly over the time left until reset. Once only the reserve is left, it waits
+// for the reset.
+func (c *Collector) pace(ctx context.Context) {
+	if !c.policy.Throttle {
+		return
+	}
+	c.mu.Lock()
+	st, last := c.stats, c.lastCall
+	c.mu.Unlock()
+	if st.RateRemaining < 0 || st.RateLimit == 0 || st.RateReset.IsZero() {
+		return // nothing observed yet
+	}
+	now := c.now()
+	window := st.RateReset.Sub(now)
+	if window <= 0 {
+		return // the window has reset; the next response refreshes the budget
+	}
+	reserve := int(math.Ceil(c.policy.ReserveFraction * float64(st.RateLimit)))
+	usable := st.RateRemaining - reserve
+	if usable <= 0 {
+		_ = c.waitWithCap(ctx, window, "source", "reserve", "remaining", st.RateRemaining, "reserve", reserve, "reset", st.RateReset)
+		return
+	}
+	interval := window / time.Duration(usable)
+	wait := interval - now.Sub(last)
+	if wait <= 0 {
+		return
+	}
+	slog.Debug("throttling", "wait", wait, "remaining", st.RateRemaining, "reserve", reserve, "reset", st.RateReset)
+	start := c.now()
+	_ = c.sleep(ctx, wait)
+	c.mu.Lock()
+	c.stats.ThrottleSleep += c.now().Sub(start)
+	c.mu.Unlock()
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Setting is one key of a config file. Keys are the CLI flag names without dashes.
+type Setting struct {
+	Key     string
+	Values  []string // a single value, or the items of a YAML list
+	List    bool
+	Line    int
+	Profile bool // set by the selected profile rather than at the top level
+}
+
+// Config holds the settings selected from a config file: the top-level keys, overridden key by
+// key by those of the chosen profile.
+type Config struct {
+	Path     string
+	Profile  string
+	Settings []Setting // sorted by key
+}
+
+// ListValue is implemented by repeatable flag values; only they accept YAML lists.
+type ListValue interface {
+	flag.Value
+	IsList() bool
+}
+
+// reserved keys select the file itself and cannot appear inside it.
+var reserved = map[string]bool{"config": true, "profile": true}
+
+// Load reads a YAML config file. Top-level keys mirror the CLI flags (e.g. "org", "since",
+// "exclude-bots", "pricing"); the optional "profiles" mapping holds named sets of the same keys:
+//
+//	since: 2024-01-01
+//	exclude-bots: true
+//	profiles:
+//	  acme:
+//	    org: [acme, acme-labs]
+//	    pricing: ["GPT-4o:5", "Opus:15"]
+//
+// With a non-empty profile, that profile's keys replace the top-level ones.
+func Load(path, profile string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg := &Config{Path: path, Profile: profile}
+	if len(doc.Content) == 0 {
+		if profile != "" {
+			return nil, fmt.Errorf("%s: profile %q not found (file is empty)", path, profile)
+		}
+		return cfg, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of option names to values", path, root.Line)
+	}
+	settings := map[string]Setting{}
+	var profiles *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		k, v := root.Content[i], root.Content[i+1]
+		if k.Value == "profiles" {
+			if v.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%s:%d: profiles must be a mapping of profile names to options", path, v.Line)
+			}
+			profiles = v
+			continue
+		}
+		s, err := setting(path, k, v)
+		if err != nil {
+			return nil, err
+		}
+		settings[s.Key] = s
+	}
+	if profile != "" {
+		var names []string
+		var selected *yaml.Node
+		if profiles != nil {
+			for i := 0; i+1 < len(profiles.Content); i += 2 {
+				names = append(names, profiles.Content[i].Value)
+				if profiles.Content[i].Value == profile {
+					selected = profiles.Content[i+1]
+				}
+			}
+		}
+		if selected == nil {
+			if len(names) == 0 {
+				return nil, fmt.Errorf("%s: profile %q not found (no profiles defined)", path, profile)
+			}
+			return nil, fmt.Errorf("%s: profile %q not found (available: %s)", path, profile, strings.Join(names, ", "))
+		}
+		if selected.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: profile %q must be a mapping of option names to values", path, selected.Line, profile)
+		}
+		for i := 0; i+1 < len(selected.Content); i += 2 {
+			s, err := setting(path, selected.Content[i], selected.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			s.Profile = true
+			settings[s.Key] = s
+		}
+	}
+	for _, s := range settings {
+		cfg.Settings = append(cfg.Settings, s)
+	}
+	sort.Slice(cfg.Settings, func(i, j int) bool { return cfg.Settings[i].Key < cfg.Settings[j].Key })
+	return cfg, nil
+}
+
+// setting converts one key/value pair; values must be scalars or lists of scalars.
+func setting(path string, k, v *yaml.Node) (Setting, error) {
+	s := Setting{Key: strings.TrimLeft(k.Value, "-"), Line: k.Line}
+	if reserved[s.Key] {
+		return s, fmt.Errorf("%s:%d: %q cannot be set inside a config file", path, k.Line, s.Key)
+	}
+	switch v.Kind {
+	case yaml.ScalarNode:
+		s.Values = []string{v.Value}
+	case yaml.SequenceNode:
+		s.List = true
+		for _, item := range v.Content {
+			if item.Kind != yaml.ScalarNode {
+				return s, fmt.Errorf("%s:%d: %s: list items must be plain values", path, item.Line, s.Key)
+			}
+			s.Values = append(s.Values, item.Value)
+		}
+	default:
+		return s, fmt.Errorf("%s:%d: %s: expected a value or a list of values", path, v.Line, s.Key)
+	}
+	return s, nil
+}
+
+// Apply sets the flags of fs from the config. Keys for which skip returns true (set on the
+// command line or through the environment) are left alone, keys that belong to another command
+// (known reports them) are ignored, and anything else that fs does not define is an error.
+// It returns, per flag name, the file location the value came from, naming the profile for keys
+// the profile set.
+func (c *Config) Apply(fs *flag.FlagSet, known, skip func(name string) bool) (map[string]string, error) {
+	origins := map[string]string{}
+	for _, s := range c.Settings {
+		where := fmt.Sprintf("%s:%d", c.Path, s.Line)
+		if s.Profile {
+			where += " (profile " + c.Profile + ")"
+		}
+		f := fs.Lookup(s.Key)
+		if f == nil {
+			if known(s.Key) {
+				continue
+			}
+			return nil, fmt.Errorf("%s: unknown option %q", where, s.Key)
+		}
+		if skip(s.Key) {
+			continue
+		}
+		lv, isList := f.Value.(ListValue)
+		if s.List && !(isList && lv.IsList()) {
+			return nil, fmt.Errorf("%s: %s takes a single value, not a list", where, s.Key)
+		}
+		for _, v := range s.Values {
+			if err := fs.Set(s.Key, v); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", where, s.Key, err)
+			}
+		}
+		origins[s.Key] = where
+	}
+	return origins, nil
+}
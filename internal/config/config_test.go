@@ -0,0 +1,48 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestApplyOrigins checks that only keys set by the selected profile are reported as coming
+// from it; top-level keys keep their plain file location.
+func TestApplyOrigins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "since: 2024-01-01\norg: top\nprofiles:\n  acme:\n    org: acme\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		profile   string
+		org       string
+		orgOrigin string
+	}{
+		{"", "top", path + ":2"},
+		{"acme", "acme", path + ":5 (profile acme)"},
+	} {
+		cfg, err := Load(path, tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		org := fs.String("org", "", "")
+		since := fs.String("since", "", "")
+		none := func(string) bool { return false }
+		origins, err := cfg.Apply(fs, none, none)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *org != tt.org || *since != "2024-01-01" {
+			t.Errorf("profile %q: org=%q since=%q", tt.profile, *org, *since)
+		}
+		if origins["org"] != tt.orgOrigin {
+			t.Errorf("profile %q: org origin = %q, want %q", tt.profile, origins["org"], tt.orgOrigin)
+		}
+		if want := path + ":1"; origins["since"] != want {
+			t.Errorf("profile %q: since origin = %q, want %q", tt.profile, origins["since"], want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package fakegithub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// App is a GitHub App the server accepts JWTs from. It is installed on every org, with
+// installation IDs 100, 101, ... in the order the orgs were given to New.
+type App struct {
+	ID   int64
+	Slug string // bot login is "<Slug>[bot]"
+	Key  *rsa.PublicKey
+}
+
+// installation is an app installation an access token was minted for.
+type installation struct {
+	app     *App
+	id      int64
+	expires time.Time
+}
+
+// InstallApp registers app, so it can list its installations (GET /app/installations), mint
+// installation tokens (POST /app/installations/{id}/access_tokens) and read GET /app. Requests
+// to those endpoints must carry an RS256 JWT signed with the app's key.
+func (s *Server) InstallApp(app App) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps = append(s.apps, &app)
+}
+
+// InstallationTokens returns the number of installation tokens minted so far.
+func (s *Server) InstallationTokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.minted
+}
+
+// authenticate checks the request's credentials: app endpoints need an app JWT, installation
+// tokens must have been minted here and not expired, and other tokens are accepted. It returns
+// the installation behind an installation token, or nil. On failure it has written the 401.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*installation, bool) {
+	token := credential(r)
+	if r.URL.Path == "/app" || strings.HasPrefix(r.URL.Path, "/app/") {
+		if s.appFor(token) == nil {
+			writeError(w, http.StatusUnauthorized, "A JSON web token could not be decoded")
+			return nil, false
+		}
+		return nil, true
+	}
+	if !strings.HasPrefix(token, "ghs_") {
+		return nil, true
+	}
+	inst := s.tokens[token]
+	if inst == nil || !time.Now().Before(inst.expires) {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return nil, false
+	}
+	return inst, true
+}
+
+// credential returns the request's token without its Bearer or token scheme.
+func credential(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "bearer ", "token ", "Token "} {
+		token = strings.TrimPrefix(token, scheme)
+	}
+	return token
+}
+
+// appFor returns the app whose key signed the unexpired JWT token, or nil.
+func (s *Server) appFor(token string) *App {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	enc := base64.RawURLEncoding
+	var claims struct {
+		Iss string `json:"iss"`
+		Exp int64  `json:"exp"`
+	}
+	b, err := enc.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(b, &claims) != nil || time.Now().Unix() >= claims.Exp {
+		return nil
+	}
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	for _, app := range s.apps {
+		if strconv.FormatInt(app.ID, 10) == claims.Iss && rsa.VerifyPKCS1v15(app.Key, crypto.SHA256, sum[:], sig) == nil {
+			return app
+		}
+	}
+	return nil
+}
+
+// handleApp serves the app endpoints for the app whose JWT authenticated the request.
+func (s *Server) handleApp(w http.ResponseWriter, r *http.Request, parts []string) {
+	app := s.appFor(credential(r))
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1:
+		writeJSON(w, map[string]any{"id": app.ID, "slug": app.Slug, "name": app.Slug})
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "installations":
+		var out []any
+		for i, o := range s.orgList {
+			out = append(out, map[string]any{"id": 100 + i, "app_id": app.ID, "account": map[string]any{"login": o.Login}})
+		}
+		writePage(w, r, out)
+	case r.Method == http.MethodPost && len(parts) == 4 && parts[1] == "installations" && parts[3] == "access_tokens":
+		id, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || id < 100 || id >= 100+int64(len(s.orgList)) {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		var b [16]byte
+		rand.Read(b[:])
+		token := "ghs_" + hex.EncodeToString(b[:])
+		inst := &installation{app: app, id: id, expires: time.Now().Add(time.Hour)}
+		s.tokens[token] = inst
+		s.minted++
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"token": token, "expires_at": inst.expires.UTC().Format(time.RFC3339)})
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
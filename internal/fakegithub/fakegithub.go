@@ -0,0 +1,570 @@
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an offline stand-in for the GitHub API, serving just what the estimator uses:
+// org repo listings, repository metadata, paginated PR lists, raw diffs, the rate_limit, user and
+// org endpoints, PR comments, the issue search, the GraphQL PR query of --fast and the GitHub App
+// endpoints (see InstallApp), with X-RateLimit-* headers on every response. Point a go-github
+// client's BaseURL at URL()+"/" (or run the CLI with --api-url).
+//
+// Any token is accepted except unknown installation tokens (ghs_...), which get 401.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	orgs      map[string]*Org
+	orgList   []*Org // in the order given to New; installation IDs follow it
+	limit     int
+	remaining int
+	reset     time.Time
+	failures  map[string]int       // diff path → 502s served so far (see PR.FailTimes)
+	inject    map[string]*injected // path → status to answer instead (see Fail)
+	requests  int
+	commentID int64 // last issue comment ID handed out
+	apps      []*App
+	tokens    map[string]*installation // minted installation tokens
+	minted    int
+}
+
+// injected is a failure queued by Fail.
+type injected struct {
+	status, times int
+}
+
+// Org is an organization and its repositories.
+type Org struct {
+	Login        string
+	Repos        []*Repo
+	TotalPrivate int // reported total_private_repos; defaults to the private repos served
+}
+
+// Repo is a repository with its pull requests, listed in creation order.
+type Repo struct {
+	Name       string
+	Private    bool
+	Archived   bool
+	Fork       bool
+	Language   string
+	Visibility string // defaults to public/private from Private
+	Topics     []string
+	PRs        []*PR
+}
+
+// PR is a pull request. DiffStatus, if set, is returned instead of the diff (e.g. 403, 404,
+// 451 or 500); FailTimes makes the diff endpoint answer 502 that many times first.
+type PR struct {
+	Number     int
+	Title      string
+	State      string // open or closed; defaults to closed when MergedAt is set, open otherwise
+	Draft      bool
+	CreatedAt  time.Time
+	MergedAt   time.Time
+	Author     string
+	Bot        bool
+	Base, Head string
+	Labels     []string
+	Diff       string
+	DiffStatus int
+	FailTimes  int
+	Comments   []*Comment
+}
+
+// Comment is an issue comment on a pull request. Comments posted through the API are authored
+// by fake-user, the login /user reports, or by "<slug>[bot]" with an app installation token.
+type Comment struct {
+	ID        int64
+	Author    string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// New starts a server for orgs with a 5000/hour rate limit.
+func New(orgs ...*Org) *Server {
+	s := &Server{orgs: map[string]*Org{}, limit: 5000, remaining: 5000, reset: time.Now().Add(time.Hour), failures: map[string]int{}, inject: map[string]*injected{}, tokens: map[string]*installation{}}
+	for _, o := range orgs {
+		s.orgs[strings.ToLower(o.Login)] = o
+		s.orgList = append(s.orgList, o)
+		for _, r := range o.Repos {
+			for _, pr := range r.PRs {
+				for _, c := range pr.Comments {
+					s.commentID = max(s.commentID, c.ID)
+				}
+			}
+		}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetRateLimit sets the remaining budget and reset time. With remaining 0 every request is
+// answered 403 with X-RateLimit-Remaining: 0 until reset passes. Reset is truncated to whole
+// seconds, as X-RateLimit-Reset reports it, so a client waiting for the header's time is let in.
+func (s *Server) SetRateLimit(remaining int, reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remaining, s.reset = remaining, reset.Truncate(time.Second)
+}
+
+// Fail makes the next times requests for path (e.g. "/repos/acme/api/pulls" or "/graphql")
+// answer status with a GitHub-style error body instead, to exercise retries and failure
+// reporting on any endpoint. Rate-limit headers are still sent.
+func (s *Server) Fail(path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inject[path] = &injected{status: status, times: times}
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Comments returns copies of the comments on a pull request, oldest first.
+func (s *Server) Comments(owner, repo string, number int) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := s.pull(owner, repo, number)
+	if pr == nil {
+		return nil
+	}
+	out := make([]Comment, 0, len(pr.Comments))
+	for _, c := range pr.Comments {
+		out = append(out, *c)
+	}
+	return out
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if !time.Now().Before(s.reset) {
+		s.remaining, s.reset = s.limit, time.Now().Add(time.Hour)
+	}
+	// Search and GraphQL have budgets of their own; only the core budget is enforced
+	switch resource := resourceOf(r.URL.Path); resource {
+	case "core":
+		if s.remaining <= 0 {
+			s.rateHeaders(w)
+			writeError(w, http.StatusForbidden, "API rate limit exceeded")
+			return
+		}
+		s.remaining--
+		s.rateHeaders(w)
+	default:
+		h := w.Header()
+		limit := 5000
+		if resource == "search" {
+			limit = 30
+		}
+		h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(limit-1))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		h.Set("X-RateLimit-Resource", resource)
+	}
+	if f := s.inject[r.URL.Path]; f != nil && f.times > 0 {
+		f.times--
+		writeError(w, f.status, http.StatusText(f.status))
+		return
+	}
+	inst, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/app" || strings.HasPrefix(r.URL.Path, "/app/"):
+		s.handleApp(w, r, parts)
+	case r.URL.Path == "/graphql" || r.URL.Path == "/api/graphql":
+		s.handleGraphQL(w, r)
+	case r.URL.Path == "/search/issues":
+		s.handleSearch(w, r)
+	case r.URL.Path == "/user" && inst != nil:
+		writeError(w, http.StatusForbidden, "Resource not accessible by integration")
+	case r.URL.Path == "/rate_limit":
+		core := map[string]any{"limit": s.limit, "remaining": s.remaining, "reset": s.reset.Unix()}
+		writeJSON(w, map[string]any{"resources": map[string]any{"core": core}, "rate": core})
+	case r.URL.Path == "/user":
+		w.Header().Set("X-OAuth-Scopes", "repo, read:org")
+		writeJSON(w, map[string]any{"login": "fake-user"})
+	case len(parts) == 4 && parts[0] == "user" && parts[1] == "memberships" && parts[2] == "orgs":
+		if s.org(parts[3]) == nil {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeJSON(w, map[string]any{"state": "active", "role": "member"})
+	case len(parts) == 2 && parts[0] == "orgs":
+		s.handleOrg(w, parts[1])
+	case len(parts) == 3 && parts[0] == "orgs" && parts[2] == "repos":
+		s.handleOrgRepos(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "repos":
+		repo := s.repo(parts[1], parts[2])
+		if repo == nil {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeJSON(w, repoJSON(s.org(parts[1]).Login, repo))
+	case len(parts) == 4 && parts[0] == "repos" && parts[3] == "pulls":
+		s.handlePulls(w, r, parts[1], parts[2])
+	case len(parts) == 5 && parts[0] == "repos" && parts[3] == "pulls":
+		s.handlePull(w, r, parts[1], parts[2], parts[4])
+	case len(parts) == 6 && parts[0] == "repos" && parts[3] == "issues" && parts[4] == "comments":
+		s.handleEditComment(w, r, parts[1], parts[2], parts[5])
+	case len(parts) == 6 && parts[0] == "repos" && parts[3] == "issues" && parts[5] == "comments":
+		s.handleComments(w, r, parts[1], parts[2], parts[4], inst)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// resourceOf names the rate-limit budget a request path counts against.
+func resourceOf(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/search/"):
+		return "search"
+	case path == "/graphql" || path == "/api/graphql":
+		return "graphql"
+	}
+	return "core"
+}
+
+func (s *Server) rateHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(s.limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(s.remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(s.reset.Unix(), 10))
+	h.Set("X-RateLimit-Resource", "core")
+}
+
+func (s *Server) org(login string) *Org { return s.orgs[strings.ToLower(login)] }
+
+func (s *Server) repo(owner, name string) *Repo {
+	o := s.org(owner)
+	if o == nil {
+		return nil
+	}
+	for _, r := range o.Repos {
+		if strings.EqualFold(r.Name, name) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleOrg(w http.ResponseWriter, login string) {
+	o := s.org(login)
+	if o == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	total := o.TotalPrivate
+	if total == 0 {
+		for _, r := range o.Repos {
+			if r.Private {
+				total++
+			}
+		}
+	}
+	writeJSON(w, map[string]any{"login": o.Login, "total_private_repos": total, "owned_private_repos": total})
+}
+
+func (s *Server) handleOrgRepos(w http.ResponseWriter, r *http.Request, login string) {
+	o := s.org(login)
+	if o == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var out []any
+	for _, repo := range o.Repos {
+		out = append(out, repoJSON(o.Login, repo))
+	}
+	writePage(w, r, out)
+}
+
+func (s *Server) handlePulls(w http.ResponseWriter, r *http.Request, owner, name string) {
+	repo := s.repo(owner, name)
+	if repo == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	prs := append([]*PR(nil), repo.PRs...)
+	sort.SliceStable(prs, func(i, j int) bool { return prs[i].CreatedAt.Before(prs[j].CreatedAt) })
+	if r.URL.Query().Get("direction") == "desc" {
+		for i, j := 0, len(prs)-1; i < j; i, j = i+1, j-1 {
+			prs[i], prs[j] = prs[j], prs[i]
+		}
+	}
+	var out []any
+	for _, pr := range prs {
+		if st := r.URL.Query().Get("state"); st != "" && st != "all" && st != pr.state() {
+			continue
+		}
+		out = append(out, prJSON(pr))
+	}
+	writePage(w, r, out)
+}
+
+// pull returns the pull request owner/name#number, or nil.
+func (s *Server) pull(owner, name string, number int) *PR {
+	repo := s.repo(owner, name)
+	if repo == nil {
+		return nil
+	}
+	for _, p := range repo.PRs {
+		if p.Number == number {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *Server) handlePull(w http.ResponseWriter, r *http.Request, owner, name, num string) {
+	n, _ := strconv.Atoi(num)
+	pr := s.pull(owner, name, n)
+	if pr == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "diff") {
+		writeJSON(w, prJSON(pr))
+		return
+	}
+	if served := s.failures[r.URL.Path]; served < pr.FailTimes {
+		s.failures[r.URL.Path] = served + 1
+		writeError(w, http.StatusBadGateway, "Server Error")
+		return
+	}
+	if pr.DiffStatus != 0 && pr.DiffStatus != http.StatusOK {
+		writeError(w, pr.DiffStatus, http.StatusText(pr.DiffStatus))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(pr.Diff))
+}
+
+// handleComments lists (GET) or creates (POST) the issue comments of a pull request. Comments
+// created with an installation token are authored by the app's bot.
+func (s *Server) handleComments(w http.ResponseWriter, r *http.Request, owner, name, num string, inst *installation) {
+	n, _ := strconv.Atoi(num)
+	pr := s.pull(owner, name, n)
+	if pr == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		var out []any
+		for _, c := range pr.Comments {
+			out = append(out, commentJSON(owner, name, n, c))
+		}
+		writePage(w, r, out)
+	case http.MethodPost:
+		body, ok := readCommentBody(w, r)
+		if !ok {
+			return
+		}
+		s.commentID++
+		now := time.Now().UTC()
+		author := "fake-user"
+		if inst != nil {
+			author = inst.app.Slug + "[bot]"
+		}
+		c := &Comment{ID: s.commentID, Author: author, Body: body, CreatedAt: now, UpdatedAt: now}
+		pr.Comments = append(pr.Comments, c)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(commentJSON(owner, name, n, c))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// handleEditComment updates (PATCH) the body of an issue comment in owner/name.
+func (s *Server) handleEditComment(w http.ResponseWriter, r *http.Request, owner, name, id string) {
+	if r.Method != http.MethodPatch {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	n, _ := strconv.ParseInt(id, 10, 64)
+	var found *Comment
+	var number int
+	if repo := s.repo(owner, name); repo != nil {
+		for _, pr := range repo.PRs {
+			for _, c := range pr.Comments {
+				if c.ID == n {
+					found, number = c, pr.Number
+				}
+			}
+		}
+	}
+	if found == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	body, ok := readCommentBody(w, r)
+	if !ok {
+		return
+	}
+	found.Body, found.UpdatedAt = body, time.Now().UTC()
+	writeJSON(w, commentJSON(owner, name, number, found))
+}
+
+func readCommentBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var in struct {
+		Body *string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Body == nil {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return "", false
+	}
+	return *in.Body, true
+}
+
+func commentJSON(owner, name string, number int, c *Comment) map[string]any {
+	return map[string]any{
+		"id":         c.ID,
+		"html_url":   fmt.Sprintf("https://github.com/%s/%s/pull/%d#issuecomment-%d", owner, name, number, c.ID),
+		"body":       c.Body,
+		"user":       map[string]any{"login": c.Author, "type": "User"},
+		"created_at": c.CreatedAt.UTC().Format(time.RFC3339),
+		"updated_at": c.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func (p *PR) state() string {
+	if p.State != "" {
+		return p.State
+	}
+	if !p.MergedAt.IsZero() {
+		return "closed"
+	}
+	return "open"
+}
+
+// refs returns the base and head branch names, defaulting to main and feature-<number>.
+func (p *PR) refs() (base, head string) {
+	base, head = p.Base, p.Head
+	if base == "" {
+		base = "main"
+	}
+	if head == "" {
+		head = fmt.Sprintf("feature-%d", p.Number)
+	}
+	return base, head
+}
+
+func repoJSON(owner string, r *Repo) map[string]any {
+	vis := r.Visibility
+	if vis == "" {
+		vis = "public"
+		if r.Private {
+			vis = "private"
+		}
+	}
+	topics := r.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+	return map[string]any{
+		"name":       r.Name,
+		"full_name":  owner + "/" + r.Name,
+		"owner":      map[string]any{"login": owner},
+		"private":    r.Private,
+		"archived":   r.Archived,
+		"fork":       r.Fork,
+		"language":   r.Language,
+		"visibility": vis,
+		"topics":     topics,
+	}
+}
+
+func prJSON(p *PR) map[string]any {
+	userType := "User"
+	if p.Bot {
+		userType = "Bot"
+	}
+	labels := []any{}
+	for _, l := range p.Labels {
+		labels = append(labels, map[string]any{"name": l})
+	}
+	base, head := p.refs()
+	out := map[string]any{
+		"number":     p.Number,
+		"title":      p.Title,
+		"state":      p.state(),
+		"draft":      p.Draft,
+		"created_at": p.CreatedAt.UTC().Format(time.RFC3339),
+		"user":       map[string]any{"login": p.Author, "type": userType},
+		"base":       map[string]any{"ref": base},
+		"head":       map[string]any{"ref": head},
+		"labels":     labels,
+	}
+	if !p.MergedAt.IsZero() {
+		out["merged_at"] = p.MergedAt.UTC().Format(time.RFC3339)
+	}
+	return out
+}
+
+// writePage serves items paginated by page/per_page with a GitHub-style Link header (next and
+// last relations).
+func writePage(w http.ResponseWriter, r *http.Request, items []any) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	per, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if per < 1 || per > 100 {
+		per = 30
+	}
+	start := (page - 1) * per
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + per
+	if end > len(items) {
+		end = len(items)
+	}
+	if end < len(items) {
+		link := func(page int) string {
+			u := *r.URL
+			q := u.Query()
+			q.Set("page", strconv.Itoa(page))
+			u.RawQuery = q.Encode()
+			u.Scheme, u.Host = "http", r.Host
+			return u.String()
+		}
+		last := (len(items) + per - 1) / per
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\", <%s>; rel=\"last\"", link(page+1), link(last)))
+	}
+	out := items[start:end]
+	if out == nil {
+		out = []any{}
+	}
+	writeJSON(w, out)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"message": msg})
+}
@@ -0,0 +1,129 @@
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphQLPageSize is the page size of the pullRequests connection, as in the estimator's query.
+const graphQLPageSize = 100
+
+// handleGraphQL answers the pull request query of --fast: repository(owner, name) →
+// pullRequests in creation order, 100 per page with an offset cursor, including additions and
+// deletions counted from each PR's diff. Other queries get a GraphQL error.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var in struct {
+		Query     string `json:"query"`
+		Variables struct {
+			Owner  string  `json:"owner"`
+			Name   string  `json:"name"`
+			Cursor *string `json:"cursor"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+	if !strings.Contains(in.Query, "pullRequests") {
+		writeGraphQLError(w, "", "fakegithub only serves the pull request query")
+		return
+	}
+	v := in.Variables
+	repo := s.repo(v.Owner, v.Name)
+	if repo == nil {
+		writeGraphQLError(w, "NOT_FOUND", fmt.Sprintf("Could not resolve to a Repository with the name '%s/%s'.", v.Owner, v.Name))
+		return
+	}
+	start := 0
+	if v.Cursor != nil {
+		n, err := strconv.Atoi(*v.Cursor)
+		if err != nil || n < 0 {
+			writeGraphQLError(w, "INVALID_CURSOR_ARGUMENTS", fmt.Sprintf("`%s` does not appear to be a valid cursor.", *v.Cursor))
+			return
+		}
+		start = n
+	}
+	prs := append([]*PR(nil), repo.PRs...)
+	sort.SliceStable(prs, func(i, j int) bool { return prs[i].CreatedAt.Before(prs[j].CreatedAt) })
+	start = min(start, len(prs))
+	end := min(start+graphQLPageSize, len(prs))
+	nodes := []any{}
+	for _, pr := range prs[start:end] {
+		nodes = append(nodes, prNode(pr))
+	}
+	writeJSON(w, map[string]any{"data": map[string]any{"repository": map[string]any{"pullRequests": map[string]any{
+		"pageInfo": map[string]any{"hasNextPage": end < len(prs), "endCursor": strconv.Itoa(end)},
+		"nodes":    nodes,
+	}}}})
+}
+
+// prNode renders a PR as a node of the --fast query.
+func prNode(p *PR) map[string]any {
+	state := "OPEN"
+	switch {
+	case !p.MergedAt.IsZero():
+		state = "MERGED"
+	case p.state() == "closed":
+		state = "CLOSED"
+	}
+	typename := "User"
+	if p.Bot {
+		typename = "Bot"
+	}
+	labels := []any{}
+	for _, l := range p.Labels {
+		labels = append(labels, map[string]any{"name": l})
+	}
+	base, head := p.refs()
+	additions, deletions := diffLines(p.Diff)
+	var merged any
+	if !p.MergedAt.IsZero() {
+		merged = p.MergedAt.UTC().Format(time.RFC3339)
+	}
+	return map[string]any{
+		"number":      p.Number,
+		"title":       p.Title,
+		"state":       state,
+		"isDraft":     p.Draft,
+		"createdAt":   p.CreatedAt.UTC().Format(time.RFC3339),
+		"mergedAt":    merged,
+		"baseRefName": base,
+		"headRefName": head,
+		"additions":   additions,
+		"deletions":   deletions,
+		"author":      map[string]any{"login": p.Author, "__typename": typename},
+		"labels":      map[string]any{"nodes": labels},
+	}
+}
+
+// diffLines counts the added and removed lines of a unified diff, excluding file headers.
+func diffLines(diff string) (additions, deletions int) {
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			additions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
+		}
+	}
+	return additions, deletions
+}
+
+// writeGraphQLError answers 200 with a GraphQL error, as GitHub does for query-level errors.
+func writeGraphQLError(w http.ResponseWriter, typ, msg string) {
+	e := map[string]any{"message": msg}
+	if typ != "" {
+		e["type"] = typ
+	}
+	writeJSON(w, map[string]any{"data": map[string]any{"repository": nil}, "errors": []any{e}})
+}
@@ -0,0 +1,108 @@
+package fakegithub
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleSearch serves GET /search/issues for pull request queries of one repository, as the
+// dry run sends them: repo:OWNER/NAME is:pr plus optional created:FROM..TO (dates or RFC 3339
+// times, * for open ends), is:merged, draft:false and base:BRANCH. Results are sorted by
+// creation (order=asc or desc) and paginated; unsupported qualifiers are rejected with 422.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var repo *Repo
+	var isPR, merged, noDrafts bool
+	var base string
+	var from, to time.Time
+	for _, term := range strings.Fields(r.URL.Query().Get("q")) {
+		key, value, _ := strings.Cut(term, ":")
+		var err error
+		switch {
+		case key == "repo":
+			owner, name, _ := strings.Cut(value, "/")
+			if repo = s.repo(owner, name); repo == nil {
+				writeError(w, http.StatusUnprocessableEntity, "Validation Failed: cannot find repository "+value)
+				return
+			}
+		case term == "is:pr":
+			isPR = true
+		case term == "is:merged":
+			merged = true
+		case term == "draft:false":
+			noDrafts = true
+		case key == "base":
+			base = value
+		case key == "created":
+			lo, hi, ok := strings.Cut(value, "..")
+			if !ok {
+				err = fmt.Errorf("expected FROM..TO, got %q", value)
+			} else if from, err = searchTime(lo, false); err == nil {
+				to, err = searchTime(hi, true)
+			}
+		default:
+			err = fmt.Errorf("unsupported qualifier %q", term)
+		}
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed: "+err.Error())
+			return
+		}
+	}
+	if repo == nil || !isPR {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed: fakegithub only searches is:pr in one repo:OWNER/NAME")
+		return
+	}
+
+	var matches []*PR
+	for _, pr := range repo.PRs {
+		prBase, _ := pr.refs()
+		switch {
+		case !from.IsZero() && pr.CreatedAt.Before(from), !to.IsZero() && pr.CreatedAt.After(to):
+		case merged && pr.MergedAt.IsZero(), noDrafts && pr.Draft, base != "" && prBase != base:
+		default:
+			matches = append(matches, pr)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].CreatedAt.Before(matches[j].CreatedAt) })
+	if r.URL.Query().Get("order") != "asc" {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	per, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if per < 1 || per > 100 {
+		per = 30
+	}
+	start := min((page-1)*per, len(matches))
+	end := min(start+per, len(matches))
+	items := []any{}
+	for _, pr := range matches[start:end] {
+		item := prJSON(pr)
+		item["pull_request"] = map[string]any{}
+		items = append(items, item)
+	}
+	writeJSON(w, map[string]any{"total_count": len(matches), "incomplete_results": false, "items": items})
+}
+
+// searchTime parses one end of a created: range. A bare date covers its whole day in UTC.
+func searchTime(v string, end bool) (time.Time, error) {
+	if v == "*" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid created date %q", v)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
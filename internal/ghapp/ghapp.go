@@ -0,0 +1,224 @@
+package ghapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultBaseURL is the REST API root used when Config.BaseURL is empty.
+const DefaultBaseURL = "https://api.github.com/"
+
+// refreshBefore renews installation tokens this long before they expire (they live one hour),
+// so a request never goes out with a token that expires in flight.
+const refreshBefore = 5 * time.Minute
+
+// Config identifies a GitHub App and the installation whose token is used for API calls.
+type Config struct {
+	AppID          int64
+	PrivateKey     *rsa.PrivateKey
+	InstallationID int64        // 0: discover the installation on Account
+	Account        string       // org (or user) the app is installed on, used when InstallationID is 0
+	BaseURL        string       // REST API root; DefaultBaseURL if empty
+	HTTPClient     *http.Client // client for app endpoints; http.DefaultClient if nil
+}
+
+// LoadPrivateKey reads an app private key in PEM form (PKCS#1 as downloaded from GitHub, or PKCS#8).
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(b)
+}
+
+// ParsePrivateKey parses a PEM-encoded RSA private key.
+func ParsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return rk, nil
+}
+
+// JWT returns an RS256 app JWT valid for nine minutes. iat is backdated a minute to tolerate
+// clock drift, as GitHub recommends.
+func (cfg *Config) JWT(now time.Time) (string, error) {
+	if cfg.PrivateKey == nil {
+		return "", errors.New("github app private key not set")
+	}
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(cfg.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	signing := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, cfg.PrivateKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + enc.EncodeToString(sig), nil
+}
+
+// NewTokenSource resolves the installation (discovering it on cfg.Account if needed) and
+// returns a token source that mints installation tokens and refreshes them before expiry.
+func NewTokenSource(ctx context.Context, cfg Config) (oauth2.TokenSource, error) {
+	cfg.setDefaults()
+	if cfg.InstallationID == 0 {
+		if cfg.Account == "" {
+			return nil, errors.New("github app: installation ID or account required")
+		}
+		id, err := cfg.findInstallation(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cfg.InstallationID = id
+	}
+	src := &installationSource{ctx: ctx, cfg: cfg}
+	tok, err := src.Token()
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.ReuseTokenSourceWithExpiry(tok, src, refreshBefore), nil
+}
+
+// BotLogin returns the login the app's installation tokens act as, "<app slug>[bot]", from
+// GET /app. Only AppID, PrivateKey, BaseURL and HTTPClient of cfg are used.
+func BotLogin(ctx context.Context, cfg Config) (string, error) {
+	cfg.setDefaults()
+	var app struct {
+		Slug string `json:"slug"`
+	}
+	if err := cfg.appRequest(ctx, http.MethodGet, "app", &app); err != nil {
+		return "", fmt.Errorf("get app: %w", err)
+	}
+	if app.Slug == "" {
+		return "", errors.New("get app: empty slug in response")
+	}
+	return app.Slug + "[bot]", nil
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if !strings.HasSuffix(cfg.BaseURL, "/") {
+		cfg.BaseURL += "/"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+}
+
+// findInstallation looks up the app's installation on cfg.Account (an org or a user,
+// case-insensitively) among the app's installations.
+func (cfg *Config) findInstallation(ctx context.Context) (int64, error) {
+	const perPage = 100
+	for page := 1; ; page++ {
+		var insts []struct {
+			ID      int64 `json:"id"`
+			Account struct {
+				Login string `json:"login"`
+			} `json:"account"`
+		}
+		path := "app/installations?per_page=" + strconv.Itoa(perPage) + "&page=" + strconv.Itoa(page)
+		if err := cfg.appRequest(ctx, http.MethodGet, path, &insts); err != nil {
+			return 0, fmt.Errorf("find installation on %s: %w", cfg.Account, err)
+		}
+		for _, in := range insts {
+			if strings.EqualFold(in.Account.Login, cfg.Account) {
+				return in.ID, nil
+			}
+		}
+		if len(insts) < perPage {
+			return 0, fmt.Errorf("github app %d is not installed on %s", cfg.AppID, cfg.Account)
+		}
+	}
+}
+
+// installationSource mints a fresh installation access token on every call; it is wrapped in a
+// reusing token source so that happens only near expiry.
+type installationSource struct {
+	ctx context.Context
+	cfg Config
+}
+
+func (s *installationSource) Token() (*oauth2.Token, error) {
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "app/installations/" + strconv.FormatInt(s.cfg.InstallationID, 10) + "/access_tokens"
+	if err := s.cfg.appRequest(s.ctx, http.MethodPost, path, &out); err != nil {
+		return nil, fmt.Errorf("create installation token: %w", err)
+	}
+	if out.Token == "" {
+		return nil, errors.New("create installation token: empty token in response")
+	}
+	return &oauth2.Token{AccessToken: out.Token, TokenType: "token", Expiry: out.ExpiresAt}, nil
+}
+
+// appRequest calls an endpoint authenticated as the app itself (JWT) and decodes the JSON body
+// into v.
+func (cfg *Config) appRequest(ctx context.Context, method, path string, v any) error {
+	jwt, err := cfg.JWT(time.Now())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cfg.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var ghErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(body, &ghErr)
+		return fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, ghErr.Message)
+	}
+	return json.Unmarshal(body, v)
+}
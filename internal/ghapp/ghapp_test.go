@@ -0,0 +1,268 @@
+package ghapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testKey is shared by the tests; generating RSA keys is slow.
+var testKey = func() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+// verifyJWT checks an app JWT's RS256 signature against pub and returns its claims.
+func verifyJWT(t *testing.T, token string, pub *rsa.PublicKey) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT %q: want three parts", token)
+	}
+	enc := base64.RawURLEncoding
+	var header map[string]string
+	if b, err := enc.DecodeString(parts[0]); err != nil || json.Unmarshal(b, &header) != nil {
+		t.Fatalf("JWT header %q does not decode", parts[0])
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		t.Errorf("JWT header = %v, want RS256 JWT", header)
+	}
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("JWT signature: %v", err)
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		t.Errorf("JWT signature does not verify: %v", err)
+	}
+	var claims map[string]any
+	if b, err := enc.DecodeString(parts[1]); err != nil || json.Unmarshal(b, &claims) != nil {
+		t.Fatalf("JWT claims %q do not decode", parts[1])
+	}
+	return claims
+}
+
+func TestJWT(t *testing.T) {
+	cfg := Config{AppID: 1234, PrivateKey: testKey}
+	now := time.Unix(1700000000, 0)
+	token, err := cfg.JWT(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verifyJWT(t, token, &testKey.PublicKey)
+	if claims["iss"] != "1234" {
+		t.Errorf("iss = %v, want \"1234\"", claims["iss"])
+	}
+	if iat := claims["iat"].(float64); int64(iat) != now.Add(-time.Minute).Unix() {
+		t.Errorf("iat = %v, want a minute before now", iat)
+	}
+	if exp := claims["exp"].(float64); int64(exp) != now.Add(9*time.Minute).Unix() {
+		t.Errorf("exp = %v, want nine minutes after now", exp)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 1024)
+	parts := strings.Split(token, ".")
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if rsa.VerifyPKCS1v15(&other.PublicKey, crypto.SHA256, sum[:], sig) == nil {
+		t.Error("JWT verifies with an unrelated key")
+	}
+
+	if _, err := (&Config{AppID: 1}).JWT(now); err == nil {
+		t.Error("JWT without a private key succeeded")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey)})
+	der, err := x509.MarshalPKCS8PrivateKey(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	for name, b := range map[string][]byte{"PKCS#1": pkcs1, "PKCS#8": pkcs8} {
+		k, err := ParsePrivateKey(b)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !k.Equal(testKey) {
+			t.Errorf("%s: parsed a different key", name)
+		}
+	}
+	for name, b := range map[string][]byte{
+		"not PEM":  []byte("not a key"),
+		"bad DER":  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("junk")}),
+		"empty":    nil,
+		"cert PEM": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{0x30, 0x00}}),
+	} {
+		if _, err := ParsePrivateKey(b); err == nil {
+			t.Errorf("%s: parsed", name)
+		}
+	}
+}
+
+// appServer is a fake GitHub serving the app endpoints. Every request must carry a valid app
+// JWT. The first token it mints expires within refreshBefore, later ones in an hour.
+type appServer struct {
+	*httptest.Server
+	t             *testing.T
+	installations []string // account logins; installation IDs are 100+index
+	mu            sync.Mutex
+	listed        int // GET /app/installations requests
+	minted        map[int64]int
+}
+
+func newAppServer(t *testing.T, accounts ...string) *appServer {
+	s := &appServer{t: t, installations: accounts, minted: map[int64]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *appServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+		return
+	}
+	if claims := verifyJWT(s.t, token, &testKey.PublicKey); claims["iss"] != "7" {
+		http.Error(w, `{"message":"wrong issuer"}`, http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/app":
+		fmt.Fprint(w, `{"id":7,"slug":"cost-estimator"}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/app/installations":
+		s.listed++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		per, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		if page < 1 || per < 1 {
+			http.Error(w, `{"message":"want page and per_page"}`, http.StatusBadRequest)
+			return
+		}
+		var out []map[string]any
+		for i := (page - 1) * per; i < len(s.installations) && i < page*per; i++ {
+			out = append(out, map[string]any{"id": 100 + i, "account": map[string]string{"login": s.installations[i]}})
+		}
+		if out == nil {
+			out = []map[string]any{}
+		}
+		json.NewEncoder(w).Encode(out)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/app/installations/") && strings.HasSuffix(r.URL.Path, "/access_tokens"):
+		id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/app/installations/"), "/access_tokens"), 10, 64)
+		if err != nil || id < 100 || id >= 100+int64(len(s.installations)) {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		s.minted[id]++
+		expires := time.Now().Add(time.Minute)
+		if s.minted[id] > 1 {
+			expires = time.Now().Add(time.Hour)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"ghs_%d_%d","expires_at":%q}`, id, s.minted[id], expires.Format(time.RFC3339))
+	default:
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	accounts := []string{"someone"}
+	for i := 0; i < 120; i++ {
+		accounts = append(accounts, fmt.Sprintf("org-%d", i))
+	}
+	accounts = append(accounts, "Acme")
+	srv := newAppServer(t, accounts...)
+	ctx := context.Background()
+
+	ts, err := NewTokenSource(ctx, Config{AppID: 7, PrivateKey: testKey, Account: "acme", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Acme is installation 221 on the second page of /app/installations
+	if srv.listed != 2 {
+		t.Errorf("installation list requests = %d, want 2 pages", srv.listed)
+	}
+	// The first token expires within the refresh margin, so the first use mints another
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "ghs_221_2" || tok.TokenType != "token" {
+		t.Errorf("token = %s %s, want refreshed ghs_221_2", tok.TokenType, tok.AccessToken)
+	}
+	// The second token is valid for an hour and is reused
+	for i := 0; i < 3; i++ {
+		if tok, err = ts.Token(); err != nil || tok.AccessToken != "ghs_221_2" {
+			t.Fatalf("reused token = %v, %v, want ghs_221_2", tok, err)
+		}
+	}
+	if srv.minted[221] != 2 {
+		t.Errorf("tokens minted = %d, want 2", srv.minted[221])
+	}
+}
+
+func TestTokenSourceInstallationID(t *testing.T) {
+	srv := newAppServer(t, "acme")
+	ts, err := NewTokenSource(context.Background(), Config{AppID: 7, PrivateKey: testKey, InstallationID: 100, BaseURL: srv.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.listed != 0 {
+		t.Errorf("installation list requests = %d, want none with an explicit ID", srv.listed)
+	}
+}
+
+func TestTokenSourceErrors(t *testing.T) {
+	srv := newAppServer(t, "acme")
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"not installed", Config{AppID: 7, PrivateKey: testKey, Account: "elsewhere", BaseURL: srv.URL}, "not installed on elsewhere"},
+		{"no account", Config{AppID: 7, PrivateKey: testKey, BaseURL: srv.URL}, "installation ID or account required"},
+		{"wrong app", Config{AppID: 8, PrivateKey: testKey, Account: "acme", BaseURL: srv.URL}, "401"},
+		{"unknown installation", Config{AppID: 7, PrivateKey: testKey, InstallationID: 999, BaseURL: srv.URL}, "create installation token"},
+		{"no key", Config{AppID: 7, Account: "acme", BaseURL: srv.URL}, "private key not set"},
+	}
+	for _, tt := range tests {
+		_, err := NewTokenSource(ctx, tt.cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestBotLogin(t *testing.T) {
+	srv := newAppServer(t, "acme")
+	login, err := BotLogin(context.Background(), Config{AppID: 7, PrivateKey: testKey, BaseURL: srv.URL})
+	if err != nil || login != "cost-estimator[bot]" {
+		t.Errorf("BotLogin = %q, %v, want cost-estimator[bot]", login, err)
+	}
+	if _, err := BotLogin(context.Background(), Config{AppID: 8, PrivateKey: testKey, BaseURL: srv.URL}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("BotLogin for another app: err = %v, want 401", err)
+	}
+}
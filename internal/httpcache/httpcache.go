@@ -0,0 +1,222 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Transport is an on-disk HTTP cache for GET requests. Responses carrying an ETag or
+// Last-Modified header are stored and later revalidated with If-None-Match/If-Modified-Since;
+// GitHub answers unchanged resources with 304, which does not count against the rate limit.
+// Requests whose context is marked with WithImmutable (e.g. diffs of merged PRs) are served from
+// disk without revalidation once stored. Entries are kept per credential, so a token never gets
+// a response fetched with another token's access.
+type Transport struct {
+	Dir  string
+	Base http.RoundTripper // http.DefaultTransport if nil
+	// Identity names the credential requests are made with, e.g. a GitHub App installation whose
+	// tokens rotate hourly. If empty, the request's Authorization header is the identity.
+	Identity string
+
+	hits, revalidated, misses atomic.Int64
+}
+
+// Stats counts how requests were served.
+type Stats struct {
+	Hits        int64 // immutable entries served without a request
+	Revalidated int64 // 304 Not Modified answered from disk
+	Misses      int64 // full responses fetched
+}
+
+// Since returns the counts recorded after prev, an earlier Stats of the same transport.
+func (s Stats) Since(prev Stats) Stats {
+	return Stats{Hits: s.Hits - prev.Hits, Revalidated: s.Revalidated - prev.Revalidated, Misses: s.Misses - prev.Misses}
+}
+
+type immutableKey struct{}
+
+// WithImmutable marks requests made with ctx as never changing, so cached copies are reused
+// without contacting the server.
+func WithImmutable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, immutableKey{}, true)
+}
+
+func isImmutable(ctx context.Context) bool {
+	v, _ := ctx.Value(immutableKey{}).(bool)
+	return v
+}
+
+// New returns a cache transport storing entries under dir, creating it if needed.
+func New(dir string, base http.RoundTripper) (*Transport, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Transport{Dir: dir, Base: base}, nil
+}
+
+// Stats returns the cache counters so far.
+func (t *Transport) Stats() Stats {
+	return Stats{Hits: t.hits.Load(), Revalidated: t.revalidated.Load(), Misses: t.misses.Load()}
+}
+
+// entry is the on-disk form of a cached response: the raw HTTP/1.1 response plus validators.
+type entry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Immutable    bool      `json:"immutable,omitempty"`
+	StoredAt     time.Time `json:"storedAt"`
+	Response     []byte    `json:"response"`
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base().RoundTrip(req)
+	}
+	key := t.key(req)
+	cached, _ := t.load(key)
+	immutable := isImmutable(req.Context())
+	if cached != nil && (cached.Immutable || immutable) {
+		if resp, err := cached.response(req); err == nil {
+			t.hits.Add(1)
+			resp.Header.Set("X-From-Cache", "1")
+			return resp, nil
+		}
+	}
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		stored, err := cached.response(req)
+		if err != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		// Fresh rate-limit and request headers come from the 304, the rest from the stored copy
+		for k, v := range resp.Header {
+			if strings.HasPrefix(k, "X-Ratelimit-") || k == "Date" || k == "X-Github-Request-Id" {
+				stored.Header[k] = v
+			}
+		}
+		stored.Header.Set("X-From-Cache", "1")
+		t.revalidated.Add(1)
+		return stored, nil
+	}
+	t.misses.Add(1)
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	etag, lastMod := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastMod == "" && !immutable {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var raw bytes.Buffer
+	stored := *resp
+	stored.Body = io.NopCloser(bytes.NewReader(body))
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	if err := stored.Write(&raw); err == nil {
+		_ = t.save(key, &entry{
+			URL:          req.URL.String(),
+			ETag:         etag,
+			LastModified: lastMod,
+			Immutable:    immutable,
+			StoredAt:     time.Now(),
+			Response:     raw.Bytes(),
+		})
+	}
+	return resp, nil
+}
+
+// key identifies a cached response by credential, URL and Accept header (a PR as JSON and as a
+// diff differ). Only a hash of the credential ends up on disk.
+func (t *Transport) key(req *http.Request) string {
+	identity := t.Identity
+	if identity == "" {
+		identity = req.Header.Get("Authorization")
+	}
+	sum := sha256.Sum256([]byte(identity + "\n" + req.URL.String() + "\n" + req.Header.Get("Accept")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *Transport) path(key string) string {
+	return filepath.Join(t.Dir, key[:2], key+".json")
+}
+
+func (t *Transport) load(key string) (*entry, error) {
+	b, err := os.ReadFile(t.path(key))
+	if err != nil {
+		return nil, err
+	}
+	var e entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// save writes e atomically so an interrupted run never leaves a truncated entry behind.
+func (t *Transport) save(key string, e *entry) error {
+	p := t.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (e *entry) response(req *http.Request) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(e.Response)), req)
+}
@@ -0,0 +1,151 @@
+package httpcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// privateServer serves /data only to the token "Bearer a", with an ETag, and counts requests.
+type privateServer struct {
+	*httptest.Server
+	calls, notModified int
+}
+
+func newPrivateServer(t *testing.T) *privateServer {
+	s := &privateServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls++
+		if r.Header.Get("Authorization") != "Bearer a" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if r.Header.Get("If-None-Match") == `W/"v1"` {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `W/"v1"`)
+		w.Write([]byte("secret"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func get(t *testing.T, tr http.RoundTripper, ctx context.Context, url, auth string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestRevalidate(t *testing.T) {
+	srv := newPrivateServer(t)
+	tr, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status, body := get(t, tr, context.Background(), srv.URL+"/data", "Bearer a"); status != http.StatusOK || body != "secret" {
+			t.Fatalf("request %d = %d %q", i, status, body)
+		}
+	}
+	if srv.calls != 3 || srv.notModified != 2 {
+		t.Errorf("calls = %d, 304s = %d, want 3 and 2", srv.calls, srv.notModified)
+	}
+	if st := tr.Stats(); st != (Stats{Revalidated: 2, Misses: 1}) {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestImmutable(t *testing.T) {
+	srv := newPrivateServer(t)
+	tr, _ := New(t.TempDir(), nil)
+	ctx := WithImmutable(context.Background())
+	for i := 0; i < 3; i++ {
+		if status, body := get(t, tr, ctx, srv.URL+"/data", "Bearer a"); status != http.StatusOK || body != "secret" {
+			t.Fatalf("request %d = %d %q", i, status, body)
+		}
+	}
+	if srv.calls != 1 {
+		t.Errorf("calls = %d, want 1", srv.calls)
+	}
+	if st := tr.Stats(); st != (Stats{Hits: 2, Misses: 1}) {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+// TestCredentialIsolation checks that entries stored for one credential are neither served
+// (immutable) nor revalidated for another, and that the credential is not written to disk.
+func TestCredentialIsolation(t *testing.T) {
+	for _, immutable := range []bool{false, true} {
+		srv := newPrivateServer(t)
+		dir := t.TempDir()
+		tr, _ := New(dir, nil)
+		ctx := context.Background()
+		if immutable {
+			ctx = WithImmutable(ctx)
+		}
+		if status, _ := get(t, tr, ctx, srv.URL+"/data", "Bearer a"); status != http.StatusOK {
+			t.Fatalf("immutable=%v: owner got %d", immutable, status)
+		}
+		for _, auth := range []string{"Bearer b", ""} {
+			if status, body := get(t, tr, ctx, srv.URL+"/data", auth); status != http.StatusNotFound || body == "secret" {
+				t.Errorf("immutable=%v, auth %q: got %d %q, want the server's 404", immutable, auth, status, body)
+			}
+		}
+		if srv.calls != 3 || srv.notModified != 0 {
+			t.Errorf("immutable=%v: calls = %d, 304s = %d, want 3 and 0", immutable, srv.calls, srv.notModified)
+		}
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				if b, _ := os.ReadFile(path); strings.Contains(string(b), "Bearer") {
+					t.Errorf("%s contains the Authorization header", path)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// TestIdentity checks that a fixed Identity keeps entries across rotating tokens (GitHub App
+// installation tokens) and separates different identities.
+func TestIdentity(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("diff"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	ctx := WithImmutable(context.Background())
+
+	app := &Transport{Dir: dir, Identity: "app:1:installation:42"}
+	get(t, app, ctx, srv.URL+"/diff", "token ghs_first")
+	get(t, app, ctx, srv.URL+"/diff", "token ghs_refreshed")
+	if calls != 1 {
+		t.Errorf("calls = %d, want the refreshed token to reuse the entry", calls)
+	}
+	other := &Transport{Dir: dir, Identity: "app:1:installation:43"}
+	get(t, other, ctx, srv.URL+"/diff", "token ghs_first")
+	if calls != 2 {
+		t.Errorf("calls = %d, want another installation to miss", calls)
+	}
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Set collects samples and writes them in the Prometheus text exposition format, grouping
+// each metric family as the format requires no matter the order samples were added in.
+type Set struct {
+	families map[string]*family
+}
+
+type family struct {
+	name, help, typ string
+	samples         []sample
+}
+
+type sample struct {
+	labels string // rendered {k="v",...}, empty without labels
+	value  float64
+}
+
+// NewSet returns an empty Set.
+func NewSet() *Set {
+	return &Set{families: map[string]*family{}}
+}
+
+// Gauge adds a gauge sample; labels are name/value pairs.
+func (s *Set) Gauge(name, help string, value float64, labels ...string) {
+	s.add("gauge", name, help, value, labels)
+}
+
+func (s *Set) add(typ, name, help string, value float64, labels []string) {
+	f, ok := s.families[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		s.families[name] = f
+	}
+	var b strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", labels[i], escape(labels[i+1]))
+	}
+	if b.Len() > 0 {
+		b.WriteByte('}')
+	}
+	f.samples = append(f.samples, sample{labels: b.String(), value: value})
+}
+
+// WriteTo writes all families sorted by name.
+func (s *Set) WriteTo(w io.Writer) (int64, error) {
+	names := make([]string, 0, len(s.families))
+	for name := range s.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, name := range names {
+		f := s.families[name]
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", f.name, strings.ReplaceAll(f.help, "\n", " "), f.name, f.typ)
+		for _, smp := range f.samples {
+			fmt.Fprintf(cw, "%s%s %s\n", f.name, smp.labels, formatValue(smp.value))
+		}
+	}
+	if cw.err == nil {
+		cw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, cw.err
+}
+
+// WriteFile writes the set to path atomically (temp file and rename in the same directory),
+// as the node_exporter textfile collector expects.
+func (s *Set) WriteFile(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := s.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	set := NewSet()
+	set.Gauge("b_total", "Second family.", 2, "org", "acme")
+	set.Gauge("a_value", "First\nfamily.", 0.5)
+	set.Gauge("b_total", "Second family.", math.Inf(1), "org", `we"ird\\`+"\n")
+	var b strings.Builder
+	n, err := set.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP a_value First family.
+# TYPE a_value gauge
+a_value 0.5
+# HELP b_total Second family.
+# TYPE b_total gauge
+b_total{org="acme"} 2
+b_total{org="we\"ird\\\\\n"} +Inf
+`
+	if b.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if n != int64(len(want)) {
+		t.Errorf("n = %d, want %d", n, len(want))
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "textfile", "pr_cost.prom")
+	set := NewSet()
+	set.Gauge("x", "X.", 1)
+	if err := set.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.HasSuffix(string(b), "x 1\n") {
+		t.Errorf("file = %q, %v", b, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want no leftover temp files", len(entries))
+	}
+}
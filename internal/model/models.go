@@ -2,15 +2,30 @@ package model
 
 import "time"
 
+// Cost is the estimated monthly spend at one model's price.
+type Cost struct {
+	Name       string  `json:"name"`
+	MonthlyUSD float64 `json:"monthlyUSD"`
+}
+
 // RepoSummary holds per-repository aggregated metrics.
 type RepoSummary struct {
+	Org               string  `json:"org"`
 	RepoName          string  `json:"repoName"`
 	TotalPRs          int     `json:"totalPRs"`
 	TotalDiffChars    int64   `json:"totalDiffChars"`
 	AvgDiffCharsPerPR float64 `json:"avgDiffCharsPerPR"`
+	DiffsSkipped      int     `json:"diffsSkipped"`
+	DiffsFailed       int     `json:"diffsFailed"`
+
+	// Fast mode only: diff chars are modeled as changed lines × CharsPerLine
+	CharsPerLine        float64 `json:"charsPerLine,omitempty"`
+	CalibrationPRs      int     `json:"calibrationPRs,omitempty"`
+	CalibrationErrorPct float64 `json:"calibrationErrorPct,omitempty"` // -1 if fewer than 2 samples
 }
 
-// OrgSummary holds organization-wide aggregated metrics and cost estimates.
+// OrgSummary holds organization-wide aggregated metrics; the org's costs are in the analysis
+// result, next to the prices they were computed with.
 type OrgSummary struct {
 	RepoCount           int     `json:"repoCount"`
 	TotalPRs            int     `json:"totalPRs"`
@@ -19,8 +34,26 @@ type OrgSummary struct {
 	AvgMonthlyPRs       float64 `json:"avgMonthlyPRs"`
 	AvgMonthlyDiffChars float64 `json:"avgMonthlyDiffChars"`
 	AvgMonthlyTokens    int64   `json:"avgMonthlyTokens"`
-	CostGPT4oUSD        float64 `json:"costGPT4oUSD"`
-	CostClaudeSonnetUSD float64 `json:"costClaudeSonnetUSD"`
+
+	// Data completeness: PRs whose diff could not be fetched and repos that failed entirely
+	DiffsSkipped        int     `json:"diffsSkipped"`
+	DiffsFailed         int     `json:"diffsFailed"`
+	ReposFailed         int     `json:"reposFailed"`
+	ReposNotCrawled     int     `json:"reposNotCrawled"` // repos skipped because the run was interrupted
+	Interrupted         bool    `json:"interrupted"`
+	DataCompletenessPct float64 `json:"dataCompletenessPct"`
+
+	// Fast mode: totals are estimates from PR line stats calibrated per repo on sampled diffs
+	Fast                bool    `json:"fast,omitempty"`
+	CharsPerLine        float64 `json:"charsPerLine,omitempty"`        // pooled over all calibration samples
+	CalibrationPRs      int     `json:"calibrationPRs,omitempty"`      // raw diffs fetched for calibration
+	CalibrationErrorPct float64 `json:"calibrationErrorPct,omitempty"` // sample-weighted mean of per-repo errors; -1 if unknown
+}
+
+// RepoFailure records a repository whose PRs could not be listed at all.
+type RepoFailure struct {
+	RepoName string `json:"repoName"`
+	Error    string `json:"error"`
 }
 
 // TimeRange tracks the first and last PR dates and the computed month span.
@@ -29,3 +62,48 @@ type TimeRange struct {
 	LastPRCreatedAt  time.Time `json:"lastPRCreatedAt"`
 	MonthsSpan       int       `json:"monthsSpan"`
 }
+
+// AuthorSummary holds org-wide PR volume and estimated cost attributed to one PR author.
+type AuthorSummary struct {
+	Author           string `json:"author"`
+	Team             string `json:"team,omitempty"`
+	TotalPRs         int    `json:"totalPRs"`
+	TotalDiffChars   int64  `json:"totalDiffChars"`
+	AvgMonthlyTokens int64  `json:"avgMonthlyTokens"`
+	Costs            []Cost `json:"costs"` // monthly cost at each analysis price, in pricing order
+}
+
+// TeamSummary holds PR volume and estimated cost aggregated over the authors of one team.
+type TeamSummary struct {
+	Team             string `json:"team"`
+	Authors          int    `json:"authors"`
+	TotalPRs         int    `json:"totalPRs"`
+	TotalDiffChars   int64  `json:"totalDiffChars"`
+	AvgMonthlyTokens int64  `json:"avgMonthlyTokens"`
+	Costs            []Cost `json:"costs"` // monthly cost at each analysis price, in pricing order
+}
+
+// ExclusionSummary reports how many PRs (and, when measured, diff chars) one exclusion rule dropped.
+type ExclusionSummary struct {
+	Rule      string `json:"rule"`
+	PRs       int    `json:"prs"`
+	DiffChars int64  `json:"diffChars"`
+	Measured  bool   `json:"measured"` // false when diffs of excluded PRs were not fetched
+}
+
+// ExcludedRepo records a repository skipped by the repo selection filters and why.
+type ExcludedRepo struct {
+	RepoName string `json:"repoName"`
+	Reason   string `json:"reason"`
+}
+
+// OrgSubtotal holds per-organization totals when several orgs are analyzed in one run.
+// Monthly figures use the combined run's months span so subtotals add up to the overall total.
+type OrgSubtotal struct {
+	Org              string `json:"org"`
+	RepoCount        int    `json:"repoCount"`
+	TotalPRs         int    `json:"totalPRs"`
+	TotalDiffChars   int64  `json:"totalDiffChars"`
+	AvgMonthlyTokens int64  `json:"avgMonthlyTokens"`
+	Costs            []Cost `json:"costs"` // monthly cost at each analysis price, in pricing order
+}
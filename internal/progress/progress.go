@@ -0,0 +1,170 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	api "pr-agent-cost-estimator/internal/api"
+)
+
+// Mode selects how progress is shown.
+type Mode string
+
+const (
+	ModeAuto Mode = "auto" // live line on a terminal, periodic log lines otherwise
+	ModeTTY  Mode = "tty"
+	ModeLog  Mode = "log"
+	ModeOff  Mode = "off"
+)
+
+// ParseMode validates a --progress value.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeAuto, ModeTTY, ModeLog, ModeOff:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid progress mode %q (want auto, tty, log or off)", s)
+	}
+}
+
+// Reporter periodically renders crawl progress: repos done/total, PRs processed, rate-limit
+// budget, time slept on rate limits and an ETA based on the average time per finished repo.
+// Live mode redraws a single line on the terminal; log mode emits "progress" records via slog.
+type Reporter struct {
+	w        io.Writer
+	live     bool
+	interval time.Duration
+	snapshot func() api.CallStats
+
+	mu      sync.Mutex
+	total   int
+	done    int
+	current string
+	start   time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a reporter writing to f that reads API counters from snapshot (usually a
+// collector's Snapshot method). In ModeAuto a live line is used only when f is a terminal.
+// It returns nil for ModeOff; all methods are no-ops on a nil *Reporter.
+func New(f *os.File, mode Mode, interval time.Duration, totalRepos int, snapshot func() api.CallStats) *Reporter {
+	if mode == ModeOff {
+		return nil
+	}
+	live := mode == ModeTTY || (mode == ModeAuto && isTerminal(f))
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if live {
+		interval = time.Second
+	}
+	return &Reporter{w: f, live: live, interval: interval, snapshot: snapshot, total: totalRepos, stop: make(chan struct{})}
+}
+
+// Start begins periodic rendering in the background.
+func (r *Reporter) Start() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.start = time.Now()
+	r.mu.Unlock()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		t := time.NewTicker(r.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-t.C:
+				r.render()
+			}
+		}
+	}()
+}
+
+// RepoStarted records the repository currently being crawled.
+func (r *Reporter) RepoStarted(name string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.current = name
+	r.mu.Unlock()
+}
+
+// RepoDone marks one repository as finished (successfully or not).
+func (r *Reporter) RepoDone() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.done++
+	r.current = ""
+	r.mu.Unlock()
+}
+
+// Stop halts rendering and prints a final progress line.
+func (r *Reporter) Stop() {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	r.wg.Wait()
+	r.render()
+	if r.live {
+		fmt.Fprintln(r.w)
+	}
+}
+
+func (r *Reporter) render() {
+	r.mu.Lock()
+	done, total, current := r.done, r.total, r.current
+	elapsed := time.Since(r.start)
+	r.mu.Unlock()
+	s := r.snapshot()
+
+	eta := "unknown"
+	if done > 0 && done <= total {
+		remaining := time.Duration(float64(elapsed) / float64(done) * float64(total-done))
+		eta = remaining.Round(time.Second).String()
+	}
+	rate := "unknown"
+	if s.RateRemaining >= 0 {
+		rate = fmt.Sprintf("%d/%d", s.RateRemaining, s.RateLimit)
+	}
+	reset := "unknown"
+	if !s.RateReset.IsZero() {
+		reset = s.RateReset.Format("15:04:05")
+	}
+	sleep := s.RateLimitSleep.Round(time.Second)
+
+	if r.live {
+		line := fmt.Sprintf("[%d/%d repos] PRs %d · API calls %d · rate %s (reset %s) · RL sleep %s · throttle %s · ETA %s",
+			done, total, s.PRsProcessed, s.APICalls, rate, reset, sleep, s.ThrottleSleep.Round(time.Second), eta)
+		if current != "" {
+			line += " · " + current
+		}
+		fmt.Fprintf(r.w, "\r\033[K%s", line)
+		return
+	}
+	slog.Info("progress", "repos_done", done, "repos_total", total, "prs", s.PRsProcessed, "api_calls", s.APICalls,
+		"rate_remaining", rate, "rate_reset", reset, "rate_limit_sleep", sleep, "throttle_sleep", s.ThrottleSleep.Round(time.Second), "elapsed", elapsed.Round(time.Second), "eta", eta, "current", current)
+}
+
+// isTerminal reports whether f is attached to a character device (a terminal).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,181 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode selects whether a Transport captures or serves fixtures.
+type Mode int
+
+const (
+	Record Mode = iota // forward to Base and append each response to its fixture
+	Replay             // serve fixtures only; unknown requests fail
+)
+
+// Transport records real GitHub exchanges into fixture files and replays them offline, so a
+// production run can be captured once and the whole pipeline rerun without network or token.
+// Each request (method, URL, Accept, body) maps to one JSON file holding the responses in the order
+// they were recorded; replay serves them in the same order and repeats the last one, so
+// sequences such as a 403 rate limit followed by a success replay faithfully.
+// Request headers (including Authorization) are never written.
+type Transport struct {
+	Dir  string
+	Mode Mode
+	Base http.RoundTripper // used in Record mode; http.DefaultTransport if nil
+
+	mu     sync.Mutex
+	served map[string]int // Replay: responses already served per fixture
+}
+
+// Exchange is one recorded response.
+type Exchange struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Accept string      `json:"accept,omitempty"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+	Raw    []byte      `json:"raw,omitempty"` // body that is not valid UTF-8 (Body is then empty)
+}
+
+// droppedHeaders are not recorded: they are per-connection or could identify the session.
+var droppedHeaders = []string{"Set-Cookie", "Content-Length", "Transfer-Encoding", "Connection"}
+
+// New returns a transport recording into or replaying from dir.
+func New(dir string, mode Mode, base http.RoundTripper) (*Transport, error) {
+	if mode == Record {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &Transport{Dir: dir, Mode: mode, Base: base, served: map[string]int{}}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, err := t.fixturePath(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.Mode == Replay {
+		return t.replay(req, path)
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	header := resp.Header.Clone()
+	for _, h := range droppedHeaders {
+		header.Del(h)
+	}
+	ex := Exchange{Method: req.Method, URL: req.URL.String(), Accept: req.Header.Get("Accept"), Status: resp.StatusCode, Header: header}
+	if utf8.Valid(body) {
+		ex.Body = string(body)
+	} else {
+		ex.Raw = body
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var all []Exchange
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &all)
+	}
+	all = append(all, ex)
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return nil, fmt.Errorf("record fixture: %w", err)
+	}
+	return resp, nil
+}
+
+func (t *Transport) replay(req *http.Request, path string) (*http.Response, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("replay: no fixture for %s %s (%s)", req.Method, req.URL, filepath.Base(path))
+	}
+	var all []Exchange
+	if err := json.Unmarshal(b, &all); err != nil || len(all) == 0 {
+		return nil, fmt.Errorf("replay: bad fixture %s: %v", path, err)
+	}
+	t.mu.Lock()
+	i := t.served[path]
+	if i < len(all)-1 {
+		t.served[path] = i + 1
+	} else {
+		i = len(all) - 1
+	}
+	t.mu.Unlock()
+	ex := all[i]
+	if ex.Raw != nil {
+		ex.Body = string(ex.Raw)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+		StatusCode:    ex.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        ex.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(ex.Body)),
+		ContentLength: int64(len(ex.Body)),
+		Request:       req,
+	}, nil
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fixturePath names the fixture after the request path for readability, plus a hash of the
+// method, full URL, Accept header and request body (GraphQL queries differ only by body) for
+// uniqueness. The host is excluded so fixtures recorded against one API URL replay against
+// another.
+func (t *Transport) fixturePath(req *http.Request) (string, error) {
+	u := *req.URL
+	u.Scheme, u.Host = "", ""
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n%s\n", req.Method, u.String(), req.Header.Get("Accept"))
+	if req.GetBody != nil {
+		// read a copy so the request body is left for the real round trip
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, body)
+		body.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	name := strings.Trim(unsafeChars.ReplaceAllString(req.URL.Path, "_"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return filepath.Join(t.Dir, name+"-"+hex.EncodeToString(h.Sum(nil)[:6])+".json"), nil
+}
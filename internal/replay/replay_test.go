@@ -0,0 +1,128 @@
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// get sends a GET through rt with the Accept header and returns the status and body.
+func get(t *testing.T, rt http.RoundTripper, url, accept string) (int, string, http.Header) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b), resp.Header
+}
+
+// TestRecordReplay records a failure followed by successes and replays them in order against
+// another host, repeating the last response; credentials and cookies are never written.
+func TestRecordReplay(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		switch {
+		case r.URL.Path == "/binary":
+			w.Write([]byte{0xff, 0xfe, 0x00})
+		case calls == 1:
+			http.Error(w, "flaky", http.StatusBadGateway)
+		default:
+			io.WriteString(w, "ok "+r.Header.Get("Accept"))
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	rec, err := New(dir, Record, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _, _ := get(t, rec, srv.URL+"/repos/acme/api/pulls/5", "diff"); status != http.StatusBadGateway {
+		t.Fatalf("recorded status = %d, want the 502", status)
+	}
+	if _, body, _ := get(t, rec, srv.URL+"/repos/acme/api/pulls/5", "diff"); body != "ok diff" {
+		t.Fatalf("recorded body = %q", body)
+	}
+	get(t, rec, srv.URL+"/repos/acme/api/pulls/5", "json")
+	get(t, rec, srv.URL+"/binary", "")
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("fixtures = %v, want one per method, URL and Accept", files)
+	}
+	for _, f := range files {
+		b, _ := os.ReadFile(f)
+		if strings.Contains(string(b), "secret-token") || strings.Contains(string(b), "session=abc") {
+			t.Errorf("%s stores credentials or cookies:\n%s", f, b)
+		}
+	}
+
+	srv.Close()
+	rep, err := New(dir, Replay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := "http://replay.invalid"
+	for i, want := range []struct {
+		status int
+		body   string
+	}{{http.StatusBadGateway, "flaky\n"}, {http.StatusOK, "ok diff"}, {http.StatusOK, "ok diff"}} {
+		status, body, header := get(t, rep, other+"/repos/acme/api/pulls/5", "diff")
+		if status != want.status || body != want.body {
+			t.Errorf("replay %d = %d %q, want %d %q", i, status, body, want.status, want.body)
+		}
+		if header.Get("X-RateLimit-Remaining") != "4999" {
+			t.Errorf("replay %d lost the rate-limit headers: %v", i, header)
+		}
+	}
+	if _, body, _ := get(t, rep, other+"/repos/acme/api/pulls/5", "json"); body != "ok json" {
+		t.Errorf("replay with another Accept = %q", body)
+	}
+	if _, body, _ := get(t, rep, other+"/binary", ""); body != "\xff\xfe\x00" {
+		t.Errorf("binary body = %q", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, other+"/repos/acme/api/pulls/6", nil)
+	if _, err := rep.RoundTrip(req); err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("unrecorded request: err = %v, want no fixture", err)
+	}
+	if _, err := New(filepath.Join(dir, "missing"), Replay, nil); err == nil {
+		t.Error("replaying from a missing directory succeeded")
+	}
+}
+
+// TestCheckedInFixtures replays testdata/acme, a crawl of the fake GitHub recorded by the main
+// package's TestPipelineReplay: the flaky diff fails once and then succeeds.
+func TestCheckedInFixtures(t *testing.T) {
+	rep, err := New(filepath.Join("testdata", "acme"), Replay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const url = "https://api.github.com/repos/acme/api/pulls/5"
+	const accept = "application/vnd.github.v3.diff"
+	if status, _, _ := get(t, rep, url, accept); status != http.StatusBadGateway {
+		t.Errorf("first diff fetch = %d, want 502", status)
+	}
+	status, body, _ := get(t, rep, url, accept)
+	if status != http.StatusOK || !strings.HasPrefix(body, "diff --git ") {
+		t.Errorf("retried diff fetch = %d %q", status, body)
+	}
+}
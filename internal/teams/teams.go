@@ -0,0 +1,72 @@
+package teams
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Unassigned is the team name used for authors without a team mapping.
+const Unassigned = "(unassigned)"
+
+// LoadFile reads a local team mapping file. See Parse for the accepted format.
+func LoadFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a team mapping and returns login -> team. Blank lines and # comments are ignored.
+// Two line forms are accepted:
+//
+//	alice platform                  (login followed by team)
+//	@my-org/platform @alice @bob    (team handle followed by member handles)
+//
+// The first mapping seen for a login wins, so each author is attributed to a single team. A
+// CODEOWNERS file maps paths to owners, not teams to members, so lines starting with a path or
+// glob ("/docs/ @org/docs", "*.go @alice") are rejected rather than misread.
+func Parse(r io.Reader) (map[string]string, error) {
+	out := map[string]string{}
+	set := func(login, team string) {
+		login = strings.TrimPrefix(login, "@")
+		if _, ok := out[login]; !ok && login != "" {
+			out[login] = team
+		}
+	}
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "@") && strings.Contains(fields[0], "/") {
+			team := fields[0][strings.LastIndex(fields[0], "/")+1:]
+			for _, m := range fields[1:] {
+				set(m, team)
+			}
+			continue
+		}
+		if strings.ContainsAny(fields[0], "/*?[") {
+			return nil, fmt.Errorf("line %d: %q is a path pattern; CODEOWNERS files are not team maps, list \"@org/team @member...\" instead", lineNo, fields[0])
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<login> <team>\" or \"@org/team @member...\", got %q", lineNo, strings.TrimSpace(line))
+		}
+		set(fields[0], fields[1])
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,40 @@
+package teams
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParse checks both line forms, first-mapping-wins and comments.
+func TestParse(t *testing.T) {
+	got, err := Parse(strings.NewReader("# teams\nalice platform\n@acme/web @bob @alice # alice stays on platform\n\ncarol data\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"alice": "platform", "bob": "web", "carol": "data"}
+	if len(got) != len(want) {
+		t.Errorf("teams = %v, want %v", got, want)
+	}
+	for login, team := range want {
+		if got[login] != team {
+			t.Errorf("%s = %q, want %q", login, got[login], team)
+		}
+	}
+}
+
+// TestParseRejectsCodeowners checks that CODEOWNERS lines, which start with a path pattern, are
+// errors instead of being read as "login team" pairs.
+func TestParseRejectsCodeowners(t *testing.T) {
+	for _, line := range []string{
+		"/path/ @org/team",
+		"/path/ @org/team @alice",
+		"* @org/owners",
+		"*.go @alice",
+		"docs/ @org/docs",
+		"apps/[a-z]* @org/apps",
+	} {
+		if _, err := Parse(strings.NewReader("alice platform\n" + line + "\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%q: err = %v, want a line 2 error", line, err)
+		}
+	}
+}
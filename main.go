@@ -2,96 +2,455 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
-	"math"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata" // --timezone must work on hosts without a zoneinfo database
 
-	tiktoken "github.com/pkoukk/tiktoken-go"
+	github "github.com/google/go-github/v61/github"
 	api "pr-agent-cost-estimator/internal/api"
+	config "pr-agent-cost-estimator/internal/config"
+	ghapp "pr-agent-cost-estimator/internal/ghapp"
+	httpcache "pr-agent-cost-estimator/internal/httpcache"
 	model "pr-agent-cost-estimator/internal/model"
+	progress "pr-agent-cost-estimator/internal/progress"
+	replay "pr-agent-cost-estimator/internal/replay"
+	teams "pr-agent-cost-estimator/internal/teams"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// Exit statuses, documented under "Exit codes" in the README and RUNBOOK.
+const (
+	exitError       = 1   // runtime failure: I/O, GitHub errors other than authentication
+	exitUsage       = 2   // invalid flags, config file or option values
+	exitIncomplete  = 3   // data completeness below --fail-on-incomplete
+	exitPreflight   = 4   // --preflight strict found visibility problems
+	exitAuth        = 5   // GitHub rejected the credentials (401, SSO authorization, GitHub App)
+	exitBudget      = 6   // a projected monthly cost exceeds --budget-usd
+	exitInterrupted = 130 // stopped by SIGINT/SIGTERM after writing partial output
 )
 
 type CLIOptions struct {
 	GitHubToken      string
-	Org              string
+	AppID            int64
+	AppKeyFile       string
+	AppInstallation  int64
+	Orgs             stringList
+	Repos            stringList
+	ReposFile        string
 	Out              string
 	Since            string
 	Until            string
+	Timezone         string
 	EventualComplete bool
 	MaxWaitReset     string
 	SleepMinMS       int
 	SleepMaxMS       int
 	RetriesNonRate   int
+	Throttle         bool
+	RateReserve      float64
+	TeamMap          string
+	TeamsFromGitHub  bool
+	ExcludeBots      bool
+	ExcludeLogins    stringList
+	ExcludeLabels    stringList
+	ExcludeHeads     stringList
+	ExcludeTitles    stringList
+	MeasureExcluded  bool
+	MergedOnly       bool
+	ExcludeClosed    bool
+	ExcludeDrafts    bool
+	BaseBranches     stringList
+	ExcludeArchived  bool
+	ExcludeForks     bool
+	IncludeRepos     stringList
+	ExcludeRepos     stringList
+	IncludeTopics    stringList
+	ExcludeTopics    stringList
+	Visibilities     stringList
+	Languages        stringList
+	FailOnIncomplete float64
+	MetricsFile      string
+	Progress         string
+	ProgressEvery    time.Duration
+	LogLevel         string
+	LogFormat        string
+	DryRun           bool
+	AssumeCharsPerPR int
+	Fast             bool
+	Preflight        string
+	CacheDir         string
+	APIURL           string
+	Record           string
+	Replay           string
+	NoCache          bool
+	CalibrationPRs   int
+	Config           string
+	Profile          string
+	Origins          map[string]string // flag name → config file location it was set from
+	Pricing          []estimator.Price // parsed --pricing for --dry-run's estimate; nil means the defaults
 }
 
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// IsList lets config files set the flag from a YAML list.
+func (l *stringList) IsList() bool { return true }
+
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s --org <ORG> --out <REPORT.html> [--github-token <TOKEN>|GITHUB_TOKEN env] [--since YYYY-MM-DD] [--until YYYY-MM-DD]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s (--org <ORG> [--org <ORG2>...] | --repos <OWNER/NAME,...> | --repos-file <FILE>) --out <REPORT.html> [--github-token <TOKEN>|GITHUB_TOKEN env] [--since DATE] [--until DATE] [--timezone TZ]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s collect|analyze|report|compare|serve|pr [flags]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Commands (run '%s <command> -h' for their flags):\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "  collect   crawl GitHub and store raw per-PR data in a dataset JSON file")
+	fmt.Fprintln(os.Stderr, "  analyze   compute summaries, tokens and costs from a dataset with any tokenizer/pricing")
+	fmt.Fprintln(os.Stderr, "  report    print the summary and render the HTML report from an analysis")
+	fmt.Fprintln(os.Stderr, "  compare   compare two analyses")
+	fmt.Fprintln(os.Stderr, "  serve     run estimates as background jobs behind an HTTP JSON API and HTML dashboard")
+	fmt.Fprintln(os.Stderr, "  pr        estimate one pull request's tokens and cost, optionally as a sticky PR comment")
+	fmt.Fprintln(os.Stderr, "Without a command, collect, analyze and report run in one go with the flags below.")
 	flag.PrintDefaults()
 }
 
+// defaultEncodingModel is the tiktoken model used when no --encoding-model is given.
+const defaultEncodingModel = "gpt-4o"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "collect":
+			runCollect(os.Args[2:])
+			return
+		case "analyze":
+			runAnalyze(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "compare":
+			runCompare(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "pr":
+			runPR(os.Args[2:])
+			return
+		}
+	}
+
+	// No command: collect + analyze + report in one process, as before subcommands existed
 	var opts CLIOptions
-	flag.StringVar(&opts.GitHubToken, "github-token", "", "GitHub token (or set GITHUB_TOKEN env)")
-	flag.StringVar(&opts.Org, "org", "", "GitHub organization to analyze")
+	var encodingModel string
+	var prices stringList
+	var budget budgetOptions
+	crawlFlags(flag.CommandLine, &opts)
 	flag.StringVar(&opts.Out, "out", "", "Output HTML report path")
-	flag.StringVar(&opts.Since, "since", "", "Optional ISO date (YYYY-MM-DD) to start analysis window")
-	flag.StringVar(&opts.Until, "until", "", "Optional ISO date (YYYY-MM-DD) to end analysis window")
-	flag.BoolVar(&opts.EventualComplete, "eventual-complete", false, "Wait through rate limit resets and retry pages/PRs until completion")
-	flag.StringVar(&opts.MaxWaitReset, "max-wait-reset", "60m", "Maximum wait time for rate-limit reset (e.g., 30m, 60m, 2h). Empty for no limit")
-	flag.IntVar(&opts.SleepMinMS, "sleep-min-ms", 200, "Min sleep jitter between API calls (ms)")
-	flag.IntVar(&opts.SleepMaxMS, "sleep-max-ms", 800, "Max sleep jitter between API calls (ms)")
-	flag.IntVar(&opts.RetriesNonRate, "retries-nonrate", 10, "Retry attempts for non-rate-limit transient errors")
+	flag.Float64Var(&opts.FailOnIncomplete, "fail-on-incomplete", 0, "Exit with status 3 if data completeness (%) is below this threshold, e.g. 95 (0 disables)")
+	flag.StringVar(&opts.MetricsFile, "metrics-file", "", "Also write Prometheus metrics to this file (textfile collector format, e.g. /var/lib/node_exporter/textfile/pr_cost.prom)")
+	analysisFlags(flag.CommandLine, &encodingModel, &prices)
+	budgetFlags(flag.CommandLine, &budget)
+	configFlags(flag.CommandLine, &opts.Config, &opts.Profile)
 	flag.Usage = usage
 	flag.Parse()
+	opts.Origins = applyConfig(flag.CommandLine, opts.Config, opts.Profile)
+	setupLogger(opts.LogLevel, opts.LogFormat)
+	pricing := parsePricing(prices)
+	budgetLimits := parseBudgets(budget, pricing)
+	opts.Pricing = pricing
 
-	if opts.GitHubToken == "" {
-		opts.GitHubToken = os.Getenv("GITHUB_TOKEN")
+	if opts.Out == "" {
+		usage()
+		os.Exit(exitUsage)
 	}
+	ds := mustCollect(opts, usage)
+	a := analyzeDataset(ds, encodingModel, pricing, nil)
+	budgets := checkBudgets(a, budgetLimits, budget.RepoPct)
+	writeReport(a, opts.Out, budgets)
+	exportMetrics(opts.MetricsFile, a)
+	postBudgetAlert(budget, a, budgets)
 
-	// Basic validation for Request 1 (will be tightened in later requests)
-	if opts.Org == "" || opts.Out == "" {
-		usage()
-		os.Exit(2)
+	if a.Org.Interrupted {
+		os.Exit(exitInterrupted)
+	}
+	checkCompleteness(a.Org, opts.FailOnIncomplete)
+	enforceBudgets(budgets)
+}
+
+// crawlFlags registers the flags that control discovery and crawling, shared by the default
+// command and collect.
+func crawlFlags(fs *flag.FlagSet, opts *CLIOptions) {
+	authFlags(fs, opts)
+	prFilterFlags(fs, opts)
+	fs.Var(&opts.Orgs, "org", "GitHub organization to analyze (repeatable or comma-separated)")
+	fs.Var(&opts.Repos, "repos", "Explicit repositories to analyze as owner/name (repeatable or comma-separated)")
+	fs.StringVar(&opts.ReposFile, "repos-file", "", "File listing repositories to analyze, one owner/name per line (# comments allowed)")
+	fs.StringVar(&opts.Since, "since", "", "Start of the analysis window: YYYY-MM-DD, RFC3339, an age such as 90d or 12w, or a period such as last-quarter (its first day)")
+	fs.StringVar(&opts.Until, "until", "", "Inclusive end of the analysis window, same forms as --since: a date or period counts through its last day")
+	fs.StringVar(&opts.Timezone, "timezone", "UTC", "IANA time zone for --since/--until days and periods, e.g. Asia/Seoul, or Local")
+	fs.BoolVar(&opts.EventualComplete, "eventual-complete", false, "Wait through rate limit resets and retry pages/PRs until completion")
+	fs.StringVar(&opts.MaxWaitReset, "max-wait-reset", "60m", "Maximum wait time for rate-limit reset (e.g., 30m, 60m, 2h). Empty for no limit")
+	fs.IntVar(&opts.SleepMinMS, "sleep-min-ms", 200, "Min sleep jitter between API calls (ms)")
+	fs.IntVar(&opts.SleepMaxMS, "sleep-max-ms", 800, "Max sleep jitter between API calls (ms)")
+	fs.IntVar(&opts.RetriesNonRate, "retries-nonrate", 10, "Retry attempts for non-rate-limit transient errors")
+	fs.BoolVar(&opts.Throttle, "throttle", false, "Proactively spread API calls evenly over the remaining rate-limit window (X-RateLimit-Remaining/Reset)")
+	fs.Float64Var(&opts.RateReserve, "rate-reserve", 0, "Fraction of the hourly rate limit to leave for other tools when --throttle is set (0..1), e.g. 0.2")
+	fs.StringVar(&opts.TeamMap, "team-map", "", "Optional team mapping file (\"login team\" or \"@org/team @login...\" lines)")
+	fs.BoolVar(&opts.TeamsFromGitHub, "teams-from-github", false, "Attribute PR authors to teams via the GitHub Teams API (needs read:org)")
+	fs.BoolVar(&opts.ExcludeArchived, "exclude-archived", false, "Skip archived repositories")
+	fs.BoolVar(&opts.ExcludeForks, "exclude-forks", false, "Skip forked repositories")
+	fs.Var(&opts.IncludeRepos, "include-repo", "Only analyze repos whose name matches this glob (repeatable)")
+	fs.Var(&opts.ExcludeRepos, "exclude-repo", "Skip repos whose name matches this glob (repeatable)")
+	fs.Var(&opts.IncludeTopics, "include-topic", "Only analyze repos having this topic (repeatable)")
+	fs.Var(&opts.ExcludeTopics, "exclude-topic", "Skip repos having this topic (repeatable)")
+	fs.Var(&opts.Visibilities, "visibility", "Only analyze repos with this visibility: public, private or internal (repeatable)")
+	fs.Var(&opts.Languages, "language", "Only analyze repos with this primary language (repeatable)")
+	fs.BoolVar(&opts.MeasureExcluded, "measure-excluded", false, "Still fetch diffs of excluded PRs to report excluded diff chars (costs API calls)")
+	fs.StringVar(&opts.Progress, "progress", "auto", "Progress output on stderr: auto (live line on a terminal, log lines otherwise), tty, log or off")
+	fs.DurationVar(&opts.ProgressEvery, "progress-interval", 30*time.Second, "Interval between progress log lines when not on a terminal")
+	fs.StringVar(&opts.LogLevel, "log-level", "info", "Diagnostic log level: debug, info, warn or error")
+	fs.StringVar(&opts.LogFormat, "log-format", "text", "Diagnostic log format on stderr: text or json")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Count PRs via the search API and print projected API calls, rate-limit waits, runtime and rough cost without fetching diffs")
+	fs.IntVar(&opts.AssumeCharsPerPR, "assume-chars-per-pr", 8000, "Average diff characters per PR assumed by --dry-run for the rough cost estimate")
+	fs.BoolVar(&opts.Fast, "fast", false, "Estimate diff chars from PR additions/deletions (GraphQL, needs a token) calibrated per repo on a few raw diffs instead of fetching every diff")
+	fs.StringVar(&opts.Record, "record", "", "Record every GitHub response into fixture files in this directory (disables the HTTP cache)")
+	fs.StringVar(&opts.Replay, "replay", "", "Replay GitHub responses from fixtures recorded with --record instead of using the network")
+	fs.StringVar(&opts.CacheDir, "cache-dir", "", "Directory for the on-disk HTTP cache (default: <user cache dir>/pr-agent-cost-estimator/http)")
+	fs.BoolVar(&opts.NoCache, "no-cache", false, "Disable the on-disk HTTP cache (ETag revalidation and cached diffs of closed PRs)")
+	fs.StringVar(&opts.Preflight, "preflight", "warn", "Check token scopes, SAML SSO, org membership and visible private repos before crawling: warn, strict (exit 4 on problems) or off")
+	fs.IntVar(&opts.CalibrationPRs, "calibration-sample", 20, "Raw diffs fetched per repository to calibrate chars per changed line in --fast mode")
+}
+
+// authFlags registers the GitHub credential and endpoint flags, shared by crawls and pr.
+func authFlags(fs *flag.FlagSet, opts *CLIOptions) {
+	fs.StringVar(&opts.GitHubToken, "github-token", "", "GitHub token (or set GITHUB_TOKEN env)")
+	fs.Int64Var(&opts.AppID, "github-app-id", 0, "Authenticate as this GitHub App instead of a token (or set GITHUB_APP_ID env)")
+	fs.StringVar(&opts.AppKeyFile, "github-app-key", "", "GitHub App private key PEM file (or set GITHUB_APP_PRIVATE_KEY_FILE env)")
+	fs.Int64Var(&opts.AppInstallation, "github-app-installation-id", 0, "GitHub App installation ID (default: discovered from the first --org or repo owner)")
+	fs.StringVar(&opts.APIURL, "api-url", "", "GitHub REST API base URL, e.g. https://ghe.example.com/api/v3/ or a local fake server (default https://api.github.com/)")
+}
+
+// prFilterFlags registers the per-PR exclusion filters, shared by crawls and pr.
+func prFilterFlags(fs *flag.FlagSet, opts *CLIOptions) {
+	fs.BoolVar(&opts.MergedOnly, "merged-only", false, "Count only merged PRs")
+	fs.BoolVar(&opts.ExcludeClosed, "exclude-closed-unmerged", false, "Exclude PRs that were closed without merging")
+	fs.BoolVar(&opts.ExcludeDrafts, "exclude-drafts", false, "Exclude draft PRs")
+	fs.Var(&opts.BaseBranches, "base-branch", "Only count PRs targeting a base branch matching this glob, e.g. \"main\" or \"release/*\" (repeatable)")
+	fs.BoolVar(&opts.ExcludeBots, "exclude-bots", false, "Exclude PRs authored by GitHub users of type Bot")
+	fs.Var(&opts.ExcludeLogins, "exclude-login", "Exclude PRs whose author login matches this glob, e.g. \"renovate*\" (repeatable)")
+	fs.Var(&opts.ExcludeLabels, "exclude-label", "Exclude PRs carrying this label (repeatable)")
+	fs.Var(&opts.ExcludeHeads, "exclude-head", "Exclude PRs whose head branch matches this glob, e.g. \"dependabot/*\" (repeatable)")
+	fs.Var(&opts.ExcludeTitles, "exclude-title", "Exclude PRs whose title matches this regex (repeatable)")
+}
+
+// configFlags registers --config and --profile.
+func configFlags(fs *flag.FlagSet, path, profile *string) {
+	fs.StringVar(path, "config", "", "YAML file with option values and named profiles; keys are flag names (precedence: flags > env > file > defaults)")
+	fs.StringVar(profile, "profile", "", "Profile from --config whose options override the file's top-level options")
+}
+
+// envFallbacks names the environment variables that take precedence over a config file.
+var envFallbacks = map[string]string{
+	"github-token":   "GITHUB_TOKEN",
+	"github-app-id":  "GITHUB_APP_ID",
+	"github-app-key": "GITHUB_APP_PRIVATE_KEY_FILE",
+}
+
+// applyConfig sets the flags of fs that were given neither on the command line nor through
+// their environment variable from the --config file. Invalid files exit with status 2.
+func applyConfig(fs *flag.FlagSet, path, profile string) map[string]string {
+	if path == "" {
+		if profile != "" {
+			slog.Error("--profile requires --config", "profile", profile)
+			os.Exit(exitUsage)
+		}
+		return nil
+	}
+	cfg, err := config.Load(path, profile)
+	if err != nil {
+		slog.Error("reading --config", "err", err)
+		os.Exit(exitUsage)
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	keys := configKeys()
+	origins, err := cfg.Apply(fs, func(name string) bool { return keys[name] }, func(name string) bool {
+		return set[name] || (envFallbacks[name] != "" && os.Getenv(envFallbacks[name]) != "")
+	})
+	if err != nil {
+		slog.Error("invalid --config", "err", err)
+		os.Exit(exitUsage)
+	}
+	return origins
+}
+
+// configKeys lists every option a config file may set, across all commands.
+func configKeys() map[string]bool {
+	fs := flag.NewFlagSet("keys", flag.ContinueOnError)
+	var opts CLIOptions
+	var encodingModel string
+	var prices stringList
+	var budget budgetOptions
+	var addr, dataDir string
+	var allowOrgs, allowedHosts stringList
+	crawlFlags(fs, &opts)
+	analysisFlags(fs, &encodingModel, &prices)
+	budgetFlags(fs, &budget)
+	serveFlags(fs, &addr, &dataDir, &allowOrgs, &allowedHosts)
+	keys := map[string]bool{"in": true, "out": true, "fail-on-incomplete": true, "metrics-file": true, "comment": true}
+	fs.VisitAll(func(f *flag.Flag) { keys[f.Name] = true })
+	return keys
+}
+
+// optionSource describes where an option value came from, for validation errors.
+func optionSource(opts CLIOptions, name string) string {
+	if where, ok := opts.Origins[name]; ok {
+		return where
+	}
+	return "--" + name
+}
+
+// setupLogger installs the diagnostics logger or exits with status 2 on invalid flags.
+func setupLogger(level, format string) {
+	logger, err := newLogger(os.Stderr, level, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	slog.SetDefault(logger)
+}
+
+// collectDataset validates the crawl options, discovers and filters repositories, runs the
+// preflight checks and crawls every selected repository, writing progress lines to w. Fatal
+// problems come back as *runError with the exit status to use; with --dry-run it prints the
+// plan and returns a nil dataset.
+func collectDataset(ctx context.Context, opts CLIOptions, w io.Writer) (*estimator.Dataset, error) {
+	return collectDatasetWith(ctx, opts, w, newCrawler)
+}
+
+// crawlerFunc returns the crawler a collect runs with, given the resolved options and policy.
+type crawlerFunc func(ctx context.Context, opts CLIOptions, policy api.Policy) (*crawler, error)
+
+// collectDatasetWith is collectDataset crawling with the crawler from crawlerFor, so serve can
+// reuse one crawler per credential across jobs.
+func collectDatasetWith(ctx context.Context, opts CLIOptions, w io.Writer, crawlerFor crawlerFunc) (*estimator.Dataset, error) {
+	if err := resolveCredentials(&opts); err != nil {
+		return nil, err
+	}
+
+	opts.Orgs = splitList(opts.Orgs)
+	opts.Repos = splitList(opts.Repos)
+	if opts.ReposFile != "" {
+		names, err := readReposFile(opts.ReposFile)
+		if err != nil {
+			return nil, fail(exitUsage, "reading --repos-file", "path", opts.ReposFile, "err", err)
+		}
+		opts.Repos = append(opts.Repos, names...)
 	}
 
-	// Parse dates if provided to validate format; ignore errors gracefully for Request 1
+	if len(opts.Orgs) == 0 && len(opts.Repos) == 0 {
+		return nil, errNoTargets
+	}
+
+	progressMode, err := progress.ParseMode(opts.Progress)
+	if err != nil {
+		return nil, fail(exitUsage, "invalid --progress", "err", err)
+	}
+
+	if opts.Record != "" && opts.Replay != "" {
+		return nil, fail(exitUsage, "--record and --replay are mutually exclusive")
+	}
+
+	switch opts.Preflight {
+	case "warn", "strict", "off":
+	default:
+		return nil, fail(exitUsage, "invalid --preflight, expected warn, strict or off", "value", opts.Preflight)
+	}
+
+	// Parse the window; a bad date is a usage error rather than a silent "all time" run
+	loc, err := time.LoadLocation(opts.Timezone)
+	if err != nil {
+		return nil, fail(exitUsage, "invalid timezone, expected an IANA name such as Asia/Seoul, UTC or Local", "value", opts.Timezone, "source", optionSource(opts, "timezone"))
+	}
+	now := time.Now()
 	var sincePtr, untilPtr *time.Time
 	if opts.Since != "" {
-		if t, err := time.Parse("2006-01-02", opts.Since); err == nil {
-			sincePtr = &t
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: invalid --since format, expected YYYY-MM-DD: %v\n", err)
+		start, _, err := parseBound(opts.Since, loc, now)
+		if err != nil {
+			return nil, fail(exitUsage, "invalid since", "source", optionSource(opts, "since"), "err", err)
 		}
+		sincePtr = &start
 	}
 	if opts.Until != "" {
-		if t, err := time.Parse("2006-01-02", opts.Until); err == nil {
-			untilPtr = &t
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: invalid --until format, expected YYYY-MM-DD: %v\n", err)
+		_, end, err := parseBound(opts.Until, loc, now)
+		if err != nil {
+			return nil, fail(exitUsage, "invalid until", "source", optionSource(opts, "until"), "err", err)
 		}
+		untilPtr = &end
+	}
+	if sincePtr != nil && untilPtr != nil && untilPtr.Before(*sincePtr) {
+		return nil, fail(exitUsage, "until is before since", "since", sincePtr.Format(time.RFC3339), "until", untilPtr.Format(time.RFC3339))
+	}
+	filter, err := newPRFilter(opts)
+	if err != nil {
+		return nil, err
 	}
+
+	repoFilter := &api.RepoFilter{
+		ExcludeArchived: opts.ExcludeArchived,
+		ExcludeForks:    opts.ExcludeForks,
+		IncludeNames:    api.Globs(opts.IncludeRepos, false),
+		ExcludeNames:    api.Globs(opts.ExcludeRepos, false),
+		IncludeTopics:   opts.IncludeTopics,
+		ExcludeTopics:   opts.ExcludeTopics,
+		Visibilities:    opts.Visibilities,
+		Languages:       opts.Languages,
+	}
+
 	// Configure API policy based on flags
 	maxWait := time.Duration(0)
 	if opts.MaxWaitReset != "" {
-		if d, err := time.ParseDuration(opts.MaxWaitReset); err == nil {
-			maxWait = d
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: invalid --max-wait-reset, using default 60m: %v\n", err)
-			maxWait = 60 * time.Minute
+		d, err := time.ParseDuration(opts.MaxWaitReset)
+		if err != nil || d < 0 {
+			return nil, fail(exitUsage, "invalid max-wait-reset, expected a duration such as 30m or 2h", "value", opts.MaxWaitReset, "source", optionSource(opts, "max-wait-reset"))
 		}
+		maxWait = d
+	}
+	if opts.RateReserve < 0 || opts.RateReserve >= 1 {
+		return nil, fail(exitUsage, "invalid --rate-reserve, expected a fraction in [0, 1)", "value", opts.RateReserve)
 	}
-	api.SetPolicy(api.Policy{
+	policy := api.Policy{
 		EventualComplete: opts.EventualComplete,
 		MaxWaitReset:     maxWait, // 0 means no cap (only if --max-wait-reset "")
 		SleepMin:         time.Duration(opts.SleepMinMS) * time.Millisecond,
 		SleepMax:         time.Duration(opts.SleepMaxMS) * time.Millisecond,
 		RetriesNonRate:   opts.RetriesNonRate,
-	})
+		Throttle:         opts.Throttle,
+		ReserveFraction:  opts.RateReserve,
+	}
+	if opts.Replay != "" {
+		// fixtures are local: pacing would only slow the replay down
+		policy.SleepMin, policy.SleepMax, policy.Throttle = 0, 0, false
+	}
 
 	// Reference data models to ensure package compiles and is wired
 	_ = model.RepoSummary{}
@@ -99,206 +458,871 @@ func main() {
 	_ = model.TimeRange{}
 
 	// Request 2: initialize GitHub client and list repositories
-	ctx := context.Background()
-	client := api.NewGitHubClient(ctx, opts.GitHubToken)
-	repos, err := api.ListAllRepos(ctx, client, opts.Org)
+	cr, err := crawlerFor(ctx, opts, policy)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing repositories for org %s: %v\n", opts.Org, err)
-		os.Exit(1)
+		return nil, err
+	}
+	collector, cache := cr.collector, cr.cache
+	// A reused crawler has counted earlier runs; this dataset reports its own calls only
+	startStats := collector.Snapshot()
+	var startCache httpcache.Stats
+	if cache != nil {
+		startCache = cache.Stats()
+	}
+	snapshot := func() api.CallStats { return collector.Snapshot().Since(startStats) }
+	var repos []*github.Repository
+	for _, org := range opts.Orgs {
+		orgRepos, err := collector.ListAllRepos(ctx, org)
+		if err != nil {
+			return nil, fail(authOr(err, exitError), "listing repositories", "org", org, "err", err)
+		}
+		fmt.Fprintf(w, "Discovered %d repositories in org %s\n", len(orgRepos), org)
+		repos = append(repos, orgRepos...)
+	}
+	if len(opts.Repos) > 0 {
+		explicit, err := collector.GetRepos(ctx, opts.Repos)
+		if err != nil {
+			return nil, fail(authOr(err, exitError), "loading repositories", "err", err)
+		}
+		fmt.Fprintf(w, "Loaded %d explicitly listed repositories\n", len(explicit))
+		repos = append(repos, explicit...)
+	}
+
+	// Preflight: a token without repo scope or SSO authorization sees only public repos, and the
+	// report would look valid while missing most of the org
+	var preflightWarnings []string
+	if opts.Preflight != "off" {
+		for _, f := range collector.Preflight(ctx, opts.Orgs, repos) {
+			slog.Warn("preflight check failed", "org", f.Org, "check", f.Check, "msg", f.Message)
+			preflightWarnings = append(preflightWarnings, f.String())
+		}
+		if len(preflightWarnings) > 0 {
+			fmt.Fprintln(w, "\n!!! PREFLIGHT: the token cannot see everything; results will undercount !!!")
+			for _, pw := range preflightWarnings {
+				fmt.Fprintf(w, " - %s\n", pw)
+			}
+			if opts.Preflight == "strict" {
+				return nil, fail(exitPreflight, "aborting: preflight checks failed (--preflight strict)", "problems", len(preflightWarnings))
+			}
+			fmt.Fprintln(w)
+		}
 	}
 
-	fmt.Printf("Discovered %d repositories in org %s\n", len(repos), opts.Org)
+	// Owners in first-seen order; the run is "multi-org" when repos span more than one owner
+	var owners []string
+	seenOwner := map[string]bool{}
+	seenRepo := map[string]bool{}
+	var excludedRepos []model.ExcludedRepo
+	var selected []*github.Repository
+	for _, r := range repos {
+		if r == nil {
+			continue
+		}
+		full := strings.ToLower(repoOwner(r) + "/" + r.GetName())
+		if seenRepo[full] {
+			continue
+		}
+		seenRepo[full] = true
+		if owner := repoOwner(r); !seenOwner[owner] {
+			seenOwner[owner] = true
+			owners = append(owners, owner)
+		}
+		selected = append(selected, r)
+	}
+	multiOrg := len(owners) > 1
+	repoLabel := func(r *github.Repository) string {
+		if multiOrg {
+			return repoOwner(r) + "/" + r.GetName()
+		}
+		return r.GetName()
+	}
+	repos = repos[:0]
+	for _, r := range selected {
+		if reason := repoFilter.Match(r); reason != "" {
+			excludedRepos = append(excludedRepos, model.ExcludedRepo{RepoName: repoLabel(r), Reason: reason})
+			continue
+		}
+		repos = append(repos, r)
+	}
+	title := strings.Join(owners, ", ")
+	if len(excludedRepos) > 0 {
+		fmt.Fprintf(w, "Selected %d repositories (%d excluded by repo filters)\n", len(repos), len(excludedRepos))
+	}
 	max := 5
 	if len(repos) < max {
 		max = len(repos)
 	}
 	if max > 0 {
-		fmt.Println("Sample repos:")
+		fmt.Fprintln(w, "Sample repos:")
 		for i := 0; i < max; i++ {
 			name := "<unknown>"
 			if repos[i] != nil {
-				name = repos[i].GetName()
+				name = repoLabel(repos[i])
 			}
-			fmt.Printf(" - %s\n", name)
+			fmt.Fprintf(w, " - %s\n", name)
 		}
 	}
 
-	// Request 4: fetch PR diffs per repo, aggregate per-repo and org summaries, and print
-	var repoSummaries []model.RepoSummary
-	var orgTotalPRs int
-	var orgTotalDiffChars int64
-	var globalFirst time.Time
-	var globalLast time.Time
-	// Prepare bounded sample collection for tokenization ratio (200k characters across org)
-	var sampleBudget int64 = 200000
-	var sampleBuf strings.Builder
+	if opts.DryRun {
+		runDryRun(ctx, w, collector, repos, repoLabel, sincePtr, untilPtr, filter, opts.AssumeCharsPerPR, opts.Fast, opts.CalibrationPRs, opts.Pricing)
+		return nil, nil
+	}
 
+	// Optional team attribution: mapping file entries take precedence over GitHub team membership
+	var teamOf map[string]string
+	if opts.TeamsFromGitHub {
+		teamOf = map[string]string{}
+		for _, owner := range owners {
+			m, err := collector.OrgTeamMembership(ctx, owner)
+			if err != nil {
+				slog.Warn("failed to load team membership", "org", owner, "err", err)
+				continue
+			}
+			for login, team := range m {
+				if _, ok := teamOf[login]; !ok {
+					teamOf[login] = team
+				}
+			}
+		}
+	}
+	if opts.TeamMap != "" {
+		m, err := teams.LoadFile(opts.TeamMap)
+		if err != nil {
+			return nil, fail(exitError, "reading --team-map", "path", opts.TeamMap, "err", err)
+		}
+		if teamOf == nil {
+			teamOf = map[string]string{}
+		}
+		for login, team := range m {
+			teamOf[login] = team
+		}
+	}
+
+	// Request 4: fetch PR diffs per repo and keep the raw records for analysis
+	src := &estimator.GitHubSource{Collector: collector, Since: sincePtr, Until: untilPtr, Filter: filter, Fast: opts.Fast, CalibrationPRs: opts.CalibrationPRs}
+	var targets []estimator.Repo
 	for _, r := range repos {
-		if r == nil {
-			continue
+		if r != nil {
+			targets = append(targets, estimator.Repo{Owner: repoOwner(r), Name: r.GetName(), Label: repoLabel(r)})
 		}
-		repoName := r.GetName()
-		prCount, diffChars, first, last, err := api.RepoPRDiffStats(ctx, client, opts.Org, repoName, sincePtr, untilPtr, &sampleBudget, &sampleBuf)
+	}
+	prog := progress.New(os.Stderr, progressMode, opts.ProgressEvery, len(targets), snapshot)
+	prog.Start()
+	ds := estimator.Collect(ctx, src, targets, estimator.Options{
+		TeamOf:          teamOf,
+		Owners:          owners,
+		Fast:            opts.Fast,
+		MeasureExcluded: opts.MeasureExcluded,
+		OnRepoStart:     func(r estimator.Repo) { prog.RepoStarted(r.Label) },
+		OnRepoDone:      func(estimator.Repo) { prog.RepoDone() },
+	})
+	prog.Stop()
+	st := snapshot()
+	ds.Crawl = &estimator.CrawlStats{
+		APICalls:             st.APICalls,
+		RateLimitWaits:       st.RateLimitWaits,
+		RateLimitWaitSeconds: st.RateLimitSleep.Seconds(),
+		ThrottleWaitSeconds:  st.ThrottleSleep.Seconds(),
+		RateLimitRemaining:   st.RateRemaining,
+	}
+	if cache != nil {
+		cs := cache.Stats().Since(startCache)
+		slog.Info("http cache", "dir", cache.Dir, "hits", cs.Hits, "revalidated_304", cs.Revalidated, "misses", cs.Misses)
+	}
+
+	ds.Title = title
+	ds.Window = describeWindow(sincePtr, untilPtr, loc)
+	ds.Filters = strings.Join(append(repoFilter.Describe(), filter.Describe()...), "; ")
+	ds.ExcludedRepos = excludedRepos
+	ds.Warnings = preflightWarnings
+	return ds, nil
+}
+
+// crawler is a collector and the HTTP cache under its client, if any.
+type crawler struct {
+	collector *api.Collector
+	cache     *httpcache.Transport
+}
+
+// newCrawler builds the transport (fixtures, the HTTP cache or none), the authenticated client
+// and the collector for opts.
+func newCrawler(ctx context.Context, opts CLIOptions, policy api.Policy) (*crawler, error) {
+	var err error
+	// Reruns revalidate PR lists with ETags (304s are free) and reuse diffs of closed PRs.
+	// Recording and replaying bypass the cache so fixtures hold exactly what GitHub returned.
+	var cache *httpcache.Transport
+	var transport http.RoundTripper
+	if opts.Record != "" || opts.Replay != "" {
+		mode, dir := replay.Record, opts.Record
+		if opts.Replay != "" {
+			mode, dir = replay.Replay, opts.Replay
+		}
+		rt, err := replay.New(dir, mode, nil)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to compute diff stats for %s: %v\n", repoName, err)
-			continue
+			return nil, fail(exitUsage, "opening fixtures", "dir", dir, "err", err)
 		}
-		avgPerPR := 0.0
-		if prCount > 0 {
-			avgPerPR = float64(diffChars) / float64(prCount)
+		transport = rt
+	} else if !opts.NoCache {
+		dir := opts.CacheDir
+		if dir == "" {
+			if d, err := os.UserCacheDir(); err == nil {
+				dir = filepath.Join(d, "pr-agent-cost-estimator", "http")
+			}
 		}
-		repoSummaries = append(repoSummaries, model.RepoSummary{
-			RepoName:          repoName,
-			TotalPRs:          prCount,
-			TotalDiffChars:    diffChars,
-			AvgDiffCharsPerPR: avgPerPR,
-		})
-		orgTotalPRs += prCount
-		orgTotalDiffChars += diffChars
-		if !first.IsZero() && (globalFirst.IsZero() || first.Before(globalFirst)) {
-			globalFirst = first
+		if dir != "" {
+			if cache, err = httpcache.New(dir, nil); err != nil {
+				slog.Warn("HTTP cache disabled", "dir", dir, "err", err)
+				cache = nil
+			} else {
+				cache.Identity = cacheIdentity(opts)
+				transport = cache
+			}
 		}
-		if !last.IsZero() && (globalLast.IsZero() || last.After(globalLast)) {
-			globalLast = last
+	}
+	client, err := newClient(ctx, opts, transport)
+	if err != nil {
+		return nil, err
+	}
+	return &crawler{collector: api.NewCollector(client, policy), cache: cache}, nil
+}
+
+// resolveCredentials fills the token and GitHub App options from their environment variables
+// when the flags are unset.
+func resolveCredentials(opts *CLIOptions) error {
+	if opts.GitHubToken == "" {
+		opts.GitHubToken = os.Getenv("GITHUB_TOKEN")
+	}
+	if opts.AppID == 0 && os.Getenv("GITHUB_APP_ID") != "" {
+		id, err := strconv.ParseInt(os.Getenv("GITHUB_APP_ID"), 10, 64)
+		if err != nil {
+			return fail(exitUsage, "invalid GITHUB_APP_ID", "value", os.Getenv("GITHUB_APP_ID"), "err", err)
 		}
+		opts.AppID = id
+	}
+	if opts.AppKeyFile == "" {
+		opts.AppKeyFile = os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE")
 	}
+	if opts.AppID != 0 && opts.AppKeyFile == "" {
+		return fail(exitUsage, "--github-app-id requires --github-app-key")
+	}
+	return nil
+}
 
-	computeMonthsSpan := func(first, last time.Time) int {
-		if first.IsZero() || last.IsZero() {
-			return 0
+// newPRFilter builds the per-PR exclusion filter from the options.
+func newPRFilter(opts CLIOptions) (*api.PRFilter, error) {
+	filter := &api.PRFilter{
+		MergedOnly:            opts.MergedOnly,
+		ExcludeClosedUnmerged: opts.ExcludeClosed,
+		ExcludeDrafts:         opts.ExcludeDrafts,
+		BaseBranches:          api.Globs(opts.BaseBranches, false),
+		ExcludeBots:           opts.ExcludeBots,
+		LoginPatterns:         api.Globs(opts.ExcludeLogins, true),
+		Labels:                opts.ExcludeLabels,
+		HeadBranches:          api.Globs(opts.ExcludeHeads, false),
+		MeasureExcluded:       opts.MeasureExcluded,
+	}
+	for _, expr := range opts.ExcludeTitles {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fail(exitUsage, "invalid --exclude-title regex", "value", expr, "err", err)
 		}
-		y1, m1, d1 := first.Date()
-		y2, m2, d2 := last.Date()
-		months := (y2-y1)*12 + int(m2-m1)
-		if d2 < d1 {
-			months++ // include partial month at the end if day hasn't reached
+		filter.TitlePatterns = append(filter.TitlePatterns, re)
+	}
+	return filter, nil
+}
+
+// newClient returns a GitHub client authenticated with the App or token from opts, pointed at
+// --api-url when it is set.
+func newClient(ctx context.Context, opts CLIOptions, transport http.RoundTripper) (*github.Client, error) {
+	var client *github.Client
+	if opts.AppID != 0 && opts.Replay == "" {
+		var err error
+		if client, err = newAppClient(ctx, opts, transport); err != nil {
+			return nil, err
 		}
-		if months < 1 {
-			months = 1
+	} else {
+		client = api.NewGitHubClient(ctx, opts.GitHubToken, transport)
+	}
+	if opts.APIURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(opts.APIURL, "/") + "/")
+		if err != nil || u.Host == "" {
+			return nil, fail(exitUsage, "invalid --api-url", "value", opts.APIURL, "err", err)
 		}
-		return months
+		client.BaseURL = u
+	}
+	return client, nil
+}
+
+// cacheIdentity names the credential HTTP cache entries belong to. A GitHub App is identified by
+// its installation rather than its hourly tokens so the cache survives token refreshes; a token
+// identifies itself (the cache stores only a hash).
+func cacheIdentity(opts CLIOptions) string {
+	if opts.AppID == 0 {
+		return "token:" + opts.GitHubToken
 	}
-	monthsSpan := computeMonthsSpan(globalFirst, globalLast)
-	avgMonthlyPRs := 0.0
-	avgMonthlyDiffChars := 0.0
-	if monthsSpan > 0 {
-		avgMonthlyPRs = float64(orgTotalPRs) / float64(monthsSpan)
-		avgMonthlyDiffChars = float64(orgTotalDiffChars) / float64(monthsSpan)
+	if opts.AppInstallation != 0 {
+		return fmt.Sprintf("app:%d:installation:%d", opts.AppID, opts.AppInstallation)
 	}
+	account := ""
+	if len(opts.Orgs) > 0 {
+		account = opts.Orgs[0]
+	} else if len(opts.Repos) > 0 {
+		account, _, _ = strings.Cut(opts.Repos[0], "/")
+	}
+	return fmt.Sprintf("app:%d:account:%s", opts.AppID, strings.ToLower(account))
+}
 
-	// Request 5: Tokenization (tiktoken-go) and Cost Estimation
-	var avgMonthlyTokens int64
-	var costGPT4oUSD float64
-	var costClaudeUSD float64
-	if avgMonthlyDiffChars > 0 {
-		sampleText := sampleBuf.String()
-		if len(sampleText) > 0 {
-			enc, err := tiktoken.EncodingForModel("gpt-4o")
-			if err != nil || enc == nil {
-				// Fallback to cl100k_base if model-specific encoding is not found
-				enc, err = tiktoken.GetEncoding("cl100k_base")
-			}
-			if err == nil && enc != nil {
-				toks := enc.Encode(sampleText, nil, nil)
-				if len(toks) > 0 {
-					ratio := float64(len(toks)) / float64(len(sampleText))
-					est := ratio * avgMonthlyDiffChars
-					avgMonthlyTokens = int64(math.Round(est))
-				}
-			}
+// errNoTargets reports that neither --org nor any explicit repository was given.
+var errNoTargets = errors.New("no --org or --repos given")
+
+// runError is a fatal collect problem: the log message and attributes to report and the exit
+// status the CLI uses for it.
+type runError struct {
+	code int
+	msg  string
+	args []any
+}
+
+func (e *runError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.msg)
+	for i := 0; i+1 < len(e.args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", e.args[i], e.args[i+1])
+	}
+	return b.String()
+}
+
+// fail builds a *runError from slog-style arguments.
+func fail(code int, msg string, args ...any) error {
+	return &runError{code: code, msg: msg, args: args}
+}
+
+// mustCollect runs collectDataset for the CLI: Ctrl-C / SIGTERM cancels the crawl so waits stop
+// and partial data is kept (a second signal terminates immediately), fatal errors exit with
+// their status, and --dry-run exits 0 after printing the plan.
+func mustCollect(opts CLIOptions, usage func()) *estimator.Dataset {
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stopSignals()
+		slog.Warn("interrupt received; finishing with a partial report (signal again to abort)")
+	}()
+	ds, err := collectDataset(ctx, opts, os.Stdout)
+	var re *runError
+	switch {
+	case errors.Is(err, errNoTargets):
+		usage()
+		os.Exit(exitUsage)
+	case errors.As(err, &re):
+		slog.Error(re.msg, re.args...)
+		os.Exit(re.code)
+	case err != nil:
+		slog.Error("collect failed", "err", err)
+		os.Exit(exitError)
+	case ds == nil:
+		os.Exit(0)
+	}
+	return ds
+}
+
+// runCollect implements "collect": crawl and store the raw dataset without analyzing it.
+func runCollect(args []string) {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	var opts CLIOptions
+	crawlFlags(fs, &opts)
+	fs.StringVar(&opts.Out, "out", "", "Output dataset JSON path")
+	configFlags(fs, &opts.Config, &opts.Profile)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s collect (--org <ORG> | --repos <OWNER/NAME,...> | --repos-file <FILE>) --out <DATASET.json> [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	opts.Origins = applyConfig(fs, opts.Config, opts.Profile)
+	setupLogger(opts.LogLevel, opts.LogFormat)
+
+	if opts.Out == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	ds := mustCollect(opts, fs.Usage)
+	if err := ds.Save(opts.Out); err != nil {
+		slog.Error("writing dataset", "path", opts.Out, "err", err)
+		os.Exit(exitError)
+	}
+	records, interrupted := 0, false
+	for _, rd := range ds.Repos {
+		records += len(rd.PRs)
+		if rd.Status == estimator.StatusPartial || rd.Status == estimator.StatusNotCrawled {
+			interrupted = true
 		}
 	}
-	// Costs per PRD: GPT-4o $5/M tokens, Claude Sonnet $3/M tokens
-	if avgMonthlyTokens > 0 {
-		costGPT4oUSD = float64(avgMonthlyTokens) / 1000000.0 * 5.0
-		costClaudeUSD = float64(avgMonthlyTokens) / 1000000.0 * 3.0
+	fmt.Printf("\nDataset written to %s (%d repositories, %d PR records)\n", opts.Out, len(ds.Repos), records)
+	if interrupted {
+		fmt.Println(" - INCOMPLETE: run was interrupted; the dataset holds partial data")
+		os.Exit(exitInterrupted)
 	}
+}
 
-	windowStr := "all time"
-	if sincePtr != nil || untilPtr != nil {
-		var sinceStr, untilStr string
-		if sincePtr != nil {
-			sinceStr = sincePtr.Format("2006-01-02")
-		} else {
-			sinceStr = "beginning"
+// runAnalyze implements "analyze": compute summaries from a stored dataset, so prices and the
+// tokenizer can change without crawling GitHub again.
+func runAnalyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	var in, out, encodingModel, teamMap, logLevel, logFormat, configPath, profile string
+	var prices stringList
+	fs.StringVar(&in, "in", "", "Dataset JSON written by collect")
+	fs.StringVar(&out, "out", "", "Output analysis JSON path")
+	analysisFlags(fs, &encodingModel, &prices)
+	fs.StringVar(&teamMap, "team-map", "", "Team mapping file overriding the team attribution stored in the dataset")
+	fs.StringVar(&logLevel, "log-level", "info", "Diagnostic log level: debug, info, warn or error")
+	fs.StringVar(&logFormat, "log-format", "text", "Diagnostic log format on stderr: text or json")
+	configFlags(fs, &configPath, &profile)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s analyze --in <DATASET.json> --out <ANALYSIS.json> [--encoding-model MODEL] [--pricing NAME:USD ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	applyConfig(fs, configPath, profile)
+	setupLogger(logLevel, logFormat)
+	if in == "" || out == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	pricing := parsePricing(prices)
+
+	ds, err := estimator.LoadDataset(in)
+	if err != nil {
+		slog.Error("reading dataset", "path", in, "err", err)
+		os.Exit(exitError)
+	}
+	var teamOf map[string]string
+	if teamMap != "" {
+		m, err := teams.LoadFile(teamMap)
+		if err != nil {
+			slog.Error("reading --team-map", "path", teamMap, "err", err)
+			os.Exit(exitError)
+		}
+		teamOf = map[string]string{}
+		for login, team := range ds.Teams {
+			teamOf[login] = team
+		}
+		for login, team := range m {
+			teamOf[login] = team
+		}
+	}
+	a := analyzeDataset(ds, encodingModel, pricing, teamOf)
+	if err := a.Save(out); err != nil {
+		slog.Error("writing analysis", "path", out, "err", err)
+		os.Exit(exitError)
+	}
+	fmt.Printf("Analysis written to %s (PRs: %d, avg monthly tokens: %d", out, a.Org.TotalPRs, a.Org.AvgMonthlyTokens)
+	for _, c := range a.Costs {
+		fmt.Printf(", %s: $%.2f/month", c.Name, c.MonthlyUSD)
+	}
+	fmt.Println(")")
+}
+
+// runReport implements "report": print the summary and write the HTML report of an analysis.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var in, out, logLevel, logFormat, configPath, profile, metricsFile string
+	var failOnIncomplete float64
+	var budget budgetOptions
+	fs.StringVar(&in, "in", "", "Analysis JSON written by analyze")
+	fs.StringVar(&out, "out", "", "Output HTML report path")
+	fs.Float64Var(&failOnIncomplete, "fail-on-incomplete", 0, "Exit with status 3 if data completeness (%) is below this threshold, e.g. 95 (0 disables)")
+	fs.StringVar(&metricsFile, "metrics-file", "", "Also write Prometheus metrics to this file (textfile collector format)")
+	budgetFlags(fs, &budget)
+	fs.StringVar(&logLevel, "log-level", "info", "Diagnostic log level: debug, info, warn or error")
+	fs.StringVar(&logFormat, "log-format", "text", "Diagnostic log format on stderr: text or json")
+	configFlags(fs, &configPath, &profile)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s report --in <ANALYSIS.json> --out <REPORT.html>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	applyConfig(fs, configPath, profile)
+	setupLogger(logLevel, logFormat)
+	if in == "" || out == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	a, err := estimator.LoadAnalysis(in)
+	if err != nil {
+		slog.Error("reading analysis", "path", in, "err", err)
+		os.Exit(exitError)
+	}
+	budgets := checkBudgets(a, parseBudgets(budget, a.Pricing), budget.RepoPct)
+	writeReport(a, out, budgets)
+	exportMetrics(metricsFile, a)
+	postBudgetAlert(budget, a, budgets)
+	checkCompleteness(a.Org, failOnIncomplete)
+	enforceBudgets(budgets)
+}
+
+// runCompare implements "compare": print org-level and per-repository changes between two
+// analyses, e.g. two quarters or two pricing scenarios.
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s compare <OLD-ANALYSIS.json> <NEW-ANALYSIS.json>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	var as [2]*estimator.Analysis
+	for i, path := range fs.Args() {
+		a, err := estimator.LoadAnalysis(path)
+		if err != nil {
+			slog.Error("reading analysis", "path", path, "err", err)
+			os.Exit(exitError)
+		}
+		as[i] = a
+	}
+	printComparison(os.Stdout, as[0], as[1])
+}
+
+// analysisFlags registers the tokenizer and pricing flags shared by the default command and analyze.
+func analysisFlags(fs *flag.FlagSet, encodingModel *string, prices *stringList) {
+	fs.StringVar(encodingModel, "encoding-model", defaultEncodingModel, "tiktoken model or encoding used to count tokens, e.g. gpt-4o or cl100k_base")
+	fs.Var(prices, "pricing", "Model price as \"Name:USD per 1M input tokens\", e.g. \"GPT-4o:5\" (repeatable; default GPT-4o $5 and Claude 3.5 Sonnet $3)")
+}
+
+// parsePricing turns --pricing values into prices, defaulting to the PRD prices; invalid
+// values exit with status 2.
+func parsePricing(values []string) []estimator.Price {
+	if len(values) == 0 {
+		return estimator.DefaultPricing
+	}
+	var pricing []estimator.Price
+	for _, v := range splitList(values) {
+		p, err := estimator.ParsePrice(v)
+		if err != nil {
+			slog.Error("invalid --pricing", "value", v, "err", err)
+			os.Exit(exitUsage)
+		}
+		pricing = append(pricing, p)
+	}
+	return pricing
+}
+
+// newTokenizer loads the tokenizer for --encoding-model; tests replace it to stay offline.
+var newTokenizer = estimator.NewTiktoken
+
+// analyzeDataset runs the estimator on a dataset with the given tokenizer model and pricing.
+// A tokenizer that cannot be loaded is reported and yields zero tokens rather than failing.
+func analyzeDataset(ds *estimator.Dataset, encodingModel string, pricing []estimator.Price, teamOf map[string]string) *estimator.Analysis {
+	// Request 5: Tokenization (tiktoken-go) and Cost Estimation
+	tok, err := newTokenizer(encodingModel)
+	if err != nil {
+		slog.Warn("tokenizer unavailable; token and cost estimates will be zero", "err", err)
+	}
+	res := estimator.Analyze(ds, estimator.Options{TeamOf: teamOf}, tok, pricing)
+	return &estimator.Analysis{Meta: ds.Meta, EncodingModel: encodingModel, Result: *res}
+}
+
+// authOr returns exitAuth when err is GitHub rejecting the credentials, else code.
+func authOr(err error, code int) int {
+	if api.IsAuthError(err) {
+		return exitAuth
+	}
+	return code
+}
+
+// exportMetrics writes --metrics-file when it is set.
+func exportMetrics(path string, a *estimator.Analysis) {
+	if path == "" {
+		return
+	}
+	if err := writeMetricsFile(path, a); err != nil {
+		slog.Error("writing --metrics-file", "path", path, "err", err)
+		os.Exit(exitError)
+	}
+	fmt.Printf("Metrics written to %s\n", path)
+}
+
+// checkCompleteness exits with status 3 when --fail-on-incomplete is set and not met.
+func checkCompleteness(org model.OrgSummary, threshold float64) {
+	if threshold > 0 && org.DataCompletenessPct < threshold {
+		slog.Error("data completeness below --fail-on-incomplete", "completeness_pct", org.DataCompletenessPct, "threshold_pct", threshold)
+		os.Exit(exitIncomplete)
+	}
+}
+
+// writeReport prints the summary to stdout and writes the HTML report to out, with the budget
+// checks when --budget-usd is set.
+func writeReport(a *estimator.Analysis, out string, budgets []estimator.BudgetCheck) {
+	org := a.Org
+	multiOrg := len(a.OrgTotals) > 0
+	if a.Filters == "" {
+		fmt.Printf("\nSummary for %s (window: %s)\n", a.Title, a.Window)
+	} else {
+		fmt.Printf("\nSummary for %s (window: %s; filters: %s)\n", a.Title, a.Window, a.Filters)
+	}
+	fmt.Printf(" - Repositories analyzed: %d\n", org.RepoCount)
+	fmt.Printf(" - Total PRs: %d\n", org.TotalPRs)
+	fmt.Printf(" - Total diff chars: %d\n", org.TotalDiffChars)
+	if org.TotalPRs > 0 {
+		fmt.Printf(" - First PR created at: %s\n", a.First.Format(time.RFC3339))
+		fmt.Printf(" - Last PR created at: %s\n", a.Last.Format(time.RFC3339))
+		fmt.Printf(" - Months span (inclusive): %d\n", org.MonthsSpan)
+		fmt.Printf(" - Avg monthly PRs: %.2f\n", org.AvgMonthlyPRs)
+		fmt.Printf(" - Avg monthly diff chars: %.0f\n", org.AvgMonthlyDiffChars)
+		fmt.Printf(" - Avg monthly tokens (est): %d\n", org.AvgMonthlyTokens)
+		for _, c := range a.Costs {
+			fmt.Printf(" - Est. monthly cost (%s): $%.2f\n", c.Name, c.MonthlyUSD)
 		}
-		if untilPtr != nil {
-			untilStr = untilPtr.Format("2006-01-02")
-		} else {
-			untilStr = "now"
-		}
-		windowStr = fmt.Sprintf("%s to %s", sinceStr, untilStr)
-	}
-
-	fmt.Printf("\nSummary for %s (window: %s)\n", opts.Org, windowStr)
-	fmt.Printf(" - Repositories analyzed: %d\n", len(repos))
-	fmt.Printf(" - Total PRs: %d\n", orgTotalPRs)
-	fmt.Printf(" - Total diff chars: %d\n", orgTotalDiffChars)
-	if orgTotalPRs > 0 {
-		fmt.Printf(" - First PR created at: %s\n", globalFirst.Format(time.RFC3339))
-		fmt.Printf(" - Last PR created at: %s\n", globalLast.Format(time.RFC3339))
-		fmt.Printf(" - Months span (inclusive): %d\n", monthsSpan)
-		fmt.Printf(" - Avg monthly PRs: %.2f\n", avgMonthlyPRs)
-		fmt.Printf(" - Avg monthly diff chars: %.0f\n", avgMonthlyDiffChars)
-		fmt.Printf(" - Avg monthly tokens (est): %d\n", avgMonthlyTokens)
-		fmt.Printf(" - Est. monthly cost (GPT-4o): $%.2f\n", costGPT4oUSD)
-		fmt.Printf(" - Est. monthly cost (Claude 3.5 Sonnet): $%.2f\n", costClaudeUSD)
 	} else {
 		fmt.Println(" - No PRs found in the specified window.")
 	}
+	printBudgets(os.Stdout, budgets, len(a.OrgTotals) > 0)
+	if org.Fast {
+		if org.CalibrationErrorPct >= 0 {
+			fmt.Printf(" - FAST ESTIMATE: diff chars modeled from line stats; %d calibration diffs, %.1f chars/line, per-PR calibration error ±%.1f%%\n", org.CalibrationPRs, org.CharsPerLine, org.CalibrationErrorPct)
+		} else {
+			fmt.Printf(" - FAST ESTIMATE: diff chars modeled from line stats; %d calibration diffs, %.1f chars/line, calibration error unknown (need 2+ samples per repo)\n", org.CalibrationPRs, org.CharsPerLine)
+		}
+	}
+	if org.Interrupted {
+		fmt.Printf(" - INCOMPLETE: run was interrupted; %d repositories were not crawled\n", org.ReposNotCrawled)
+	}
+	fmt.Printf(" - Data completeness: %.1f%% (diffs skipped 403/404: %d, diffs failed after retries: %d, repos failed: %d/%d)\n",
+		org.DataCompletenessPct, org.DiffsSkipped, org.DiffsFailed, org.ReposFailed, org.RepoCount)
+	for _, rf := range a.Failures {
+		fmt.Printf("   - failed repo %s: %s\n", rf.RepoName, rf.Error)
+	}
+	if len(a.OrgTotals) > 0 {
+		fmt.Println(" - Per-org subtotals:")
+		for _, ot := range a.OrgTotals {
+			fmt.Printf("   - %s: repos=%d, PRs=%d, diff chars=%d, %s\n", ot.Org, ot.RepoCount, ot.TotalPRs, ot.TotalDiffChars, formatCosts(ot.Costs))
+		}
+	}
+	if len(a.ExcludedRepos) > 0 {
+		fmt.Printf(" - Excluded repositories: %d\n", len(a.ExcludedRepos))
+		for _, er := range a.ExcludedRepos {
+			fmt.Printf("   - %s: %s\n", er.RepoName, er.Reason)
+		}
+	}
+	if len(a.Exclusions) > 0 {
+		fmt.Println(" - Excluded PRs by rule:")
+		for _, ex := range a.Exclusions {
+			if ex.Measured {
+				fmt.Printf("   - %s: PRs=%d, diff chars=%d\n", ex.Rule, ex.PRs, ex.DiffChars)
+			} else {
+				fmt.Printf("   - %s: PRs=%d\n", ex.Rule, ex.PRs)
+			}
+		}
+	}
 
 	// Write HTML report
-	orgSummary := model.OrgSummary{
-		RepoCount:           len(repos),
-		TotalPRs:            orgTotalPRs,
-		TotalDiffChars:      orgTotalDiffChars,
-		MonthsSpan:          monthsSpan,
-		AvgMonthlyPRs:       avgMonthlyPRs,
-		AvgMonthlyDiffChars: avgMonthlyDiffChars,
-		AvgMonthlyTokens:    avgMonthlyTokens,
-		CostGPT4oUSD:        costGPT4oUSD,
-		CostClaudeSonnetUSD: costClaudeUSD,
-	}
-	if err := renderHTMLReport(opts, repoSummaries, orgSummary, windowStr); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing HTML report to %s: %v\n", opts.Out, err)
-		os.Exit(1)
-	}
-	fmt.Printf("\nHTML report written to %s\n", opts.Out)
+	data := newReportData(a)
+	data.Budgets = budgets
+	for _, c := range budgets {
+		data.OverBudget = data.OverBudget || c.Exceeded
+	}
+	if err := renderHTMLReport(out, data); err != nil {
+		slog.Error("writing HTML report", "path", out, "err", err)
+		os.Exit(exitError)
+	}
+	fmt.Printf("\nHTML report written to %s\n", out)
 
 	// Print a small sample of per-repo stats
-	if len(repoSummaries) > 0 {
+	if len(a.Repos) > 0 {
 		fmt.Println("\nPer-repo sample:")
 		max := 5
-		if len(repoSummaries) < max {
-			max = len(repoSummaries)
+		if len(a.Repos) < max {
+			max = len(a.Repos)
 		}
 		for i := 0; i < max; i++ {
-			rs := repoSummaries[i]
-			fmt.Printf(" - %s: PRs=%d, diff chars=%d, avg/PR=%.0f\n", rs.RepoName, rs.TotalPRs, rs.TotalDiffChars, rs.AvgDiffCharsPerPR)
+			rs := a.Repos[i]
+			name := rs.RepoName
+			if multiOrg {
+				name = rs.Org + "/" + rs.RepoName
+			}
+			fmt.Printf(" - %s: PRs=%d, diff chars=%d, avg/PR=%.0f\n", name, rs.TotalPRs, rs.TotalDiffChars, rs.AvgDiffCharsPerPR)
 		}
 	}
+	if len(a.Authors) > 0 {
+		fmt.Println("\nTop authors by diff chars:")
+		max := 5
+		if len(a.Authors) < max {
+			max = len(a.Authors)
+		}
+		for i := 0; i < max; i++ {
+			as := a.Authors[i]
+			fmt.Printf(" - %s: PRs=%d, diff chars=%d, %s\n", as.Author, as.TotalPRs, as.TotalDiffChars, formatCosts(as.Costs))
+		}
+	}
+	if len(a.Teams) > 0 {
+		fmt.Println("\nPer-team breakdown:")
+		for _, ts := range a.Teams {
+			fmt.Printf(" - %s: authors=%d, PRs=%d, diff chars=%d, %s\n", ts.Team, ts.Authors, ts.TotalPRs, ts.TotalDiffChars, formatCosts(ts.Costs))
+		}
+	}
+
 }
 
-// renderHTMLReport writes a single-file HTML report to opts.Out using the computed data.
-func renderHTMLReport(opts CLIOptions, repos []model.RepoSummary, org model.OrgSummary, window string) error {
-	// Prepare data for template
-	type reportData struct {
-		OrgName     string
-		Window      string
-		GeneratedAt string
-		Org         model.OrgSummary
-		Repos       []model.RepoSummary
+// formatCosts renders a summary row's per-price monthly costs for the run summary, e.g.
+// "est. monthly GPT-4o=$1.00, Claude 3.5 Sonnet=$0.60".
+func formatCosts(costs []estimator.Cost) string {
+	parts := make([]string, 0, len(costs))
+	for _, c := range costs {
+		parts = append(parts, fmt.Sprintf("%s=$%.2f", c.Name, c.MonthlyUSD))
 	}
-	data := reportData{
-		OrgName:     opts.Org,
-		Window:      window,
-		GeneratedAt: time.Now().Format(time.RFC3339),
-		Org:         org,
-		Repos:       repos,
+	return "est. monthly " + strings.Join(parts, ", ")
+}
+
+// newLogger builds the diagnostics logger for --log-level and --log-format.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q (want debug, info, warn or error)", level)
 	}
+	hopts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, hopts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, hopts)), nil
+	default:
+		return nil, fmt.Errorf("invalid --log-format %q (want text or json)", format)
+	}
+}
+
+// splitList flattens comma-separated flag values and drops empty entries.
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// readReposFile reads owner/name entries, one per line; blank lines and # comments are ignored.
+func readReposFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+// repoOwner returns the owner login of a repository, falling back to the full name prefix.
+func repoOwner(r *github.Repository) string {
+	if login := r.GetOwner().GetLogin(); login != "" {
+		return login
+	}
+	owner, _, _ := strings.Cut(r.GetFullName(), "/")
+	return owner
+}
+
+// newAppClient authenticates as a GitHub App installation. Without an explicit installation ID
+// the installation on the first --org (or the first --repos owner) is used; an installation only
+// covers its own account, so other owners are limited to what that installation can see.
+func newAppClient(ctx context.Context, opts CLIOptions, transport http.RoundTripper) (*github.Client, error) {
+	key, err := ghapp.LoadPrivateKey(opts.AppKeyFile)
+	if err != nil {
+		return nil, fail(exitUsage, "reading --github-app-key", "path", opts.AppKeyFile, "err", err)
+	}
+	var accounts []string
+	seen := map[string]bool{}
+	for _, o := range opts.Orgs {
+		if k := strings.ToLower(o); !seen[k] {
+			seen[k] = true
+			accounts = append(accounts, o)
+		}
+	}
+	for _, full := range opts.Repos {
+		owner, _, _ := strings.Cut(full, "/")
+		if k := strings.ToLower(owner); owner != "" && !seen[k] {
+			seen[k] = true
+			accounts = append(accounts, owner)
+		}
+	}
+	cfg := ghapp.Config{AppID: opts.AppID, PrivateKey: key, InstallationID: opts.AppInstallation, BaseURL: opts.APIURL}
+	if len(accounts) > 0 {
+		cfg.Account = accounts[0]
+	}
+	if len(accounts) > 1 {
+		slog.Warn("github app auth uses one installation; other owners are limited to what it can access", "installation_account", cfg.Account, "owners", accounts)
+	}
+	ts, err := ghapp.NewTokenSource(ctx, cfg)
+	if err != nil {
+		return nil, fail(exitAuth, "github app authentication", "app_id", opts.AppID, "err", err)
+	}
+	if opts.GitHubToken != "" {
+		slog.Info("github app auth configured; ignoring the personal access token")
+	}
+	return api.NewGitHubClientWithTokenSource(ctx, ts, transport), nil
+}
+
+// reportData is everything the HTML report template renders.
+type reportData struct {
+	OrgName     string
+	Window      string
+	Filters     string
+	GeneratedAt string
+	Org         model.OrgSummary
+	MultiOrg    bool
+	OrgTotals   []model.OrgSubtotal
+	Repos       []model.RepoSummary
+	Authors     []model.AuthorSummary
+	Teams       []model.TeamSummary
+	Exclusions  []model.ExclusionSummary
+	Excluded    []model.ExcludedRepo
+	Failures    []model.RepoFailure
+	Warnings    []string // preflight findings
+	Costs       []estimator.Cost
+	Budgets     []estimator.BudgetCheck // --budget-usd checks, nil without a budget
+	OverBudget  bool
+}
+
+// RepoBudgetName names a repository flagged by a budget check, as the run summary does.
+func (d reportData) RepoBudgetName(r estimator.RepoBudget) string {
+	return repoBudgetName(r, d.MultiOrg)
+}
+
+// newReportData takes the report template's data from an analysis.
+func newReportData(a *estimator.Analysis) reportData {
+	return reportData{
+		OrgName:    a.Title,
+		Window:     a.Window,
+		Filters:    a.Filters,
+		Costs:      a.Costs,
+		Org:        a.Org,
+		MultiOrg:   len(a.OrgTotals) > 0,
+		OrgTotals:  a.OrgTotals,
+		Repos:      a.Repos,
+		Authors:    a.Authors,
+		Teams:      a.Teams,
+		Exclusions: a.Exclusions,
+		Excluded:   a.ExcludedRepos,
+		Failures:   a.Failures,
+		Warnings:   a.Warnings,
+	}
+}
+
+// renderHTMLReport writes a single-file HTML report to out using the computed data.
+func renderHTMLReport(out string, data reportData) error {
+	data.GeneratedAt = time.Now().Format(time.RFC3339)
 
 	// Ensure output directory exists (if any)
-	dir := filepath.Dir(opts.Out)
+	dir := filepath.Dir(out)
 	if dir != "" && dir != "." {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return err
@@ -311,7 +1335,7 @@ func renderHTMLReport(opts CLIOptions, repos []model.RepoSummary, org model.OrgS
 <head>
   <meta charset="utf-8" />
   <meta name="viewport" content="width=device-width, initial-scale=1" />
-  <title>{{.OrgName}} — PR Activity & AI Review Cost Report</title>
+  <title>{{if .Org.Interrupted}}[INCOMPLETE] {{end}}{{.OrgName}} — PR Activity & AI Review Cost Report</title>
   <style>
     body { font-family: -apple-system, BlinkMacSystemFont, Segoe UI, Roboto, Helvetica, Arial, sans-serif; margin: 2rem; color: #222; }
     h1 { font-size: 1.8rem; margin-bottom: 0.2rem; }
@@ -329,7 +1353,30 @@ func renderHTMLReport(opts CLIOptions, repos []model.RepoSummary, org model.OrgS
 </head>
 <body>
   <h1>{{.OrgName}} — PR 활동 및 AI 리뷰 비용 예측 리포트</h1>
-  <div class="sub">분석 기간: {{.Window}} · 생성 시각: {{.GeneratedAt}}</div>
+  {{if .Org.Interrupted}}
+  <div class="card" style="border-color:#e0a800;background:#fff8e1">
+    <strong>⚠️ 불완전한 리포트 (INCOMPLETE):</strong> 실행이 중단되어 {{.Org.ReposNotCrawled}}개 레포지토리를 수집하지 못했습니다. 아래 수치는 중단 시점까지의 부분 결과입니다.
+  </div>
+  {{end}}
+  {{if .Org.Fast}}
+  <div class="card" style="border-color:#90caf9;background:#f1f8ff">
+    <strong>⚡ 빠른 추정 모드 (--fast):</strong> Diff 문자 수는 PR의 변경 줄 수(additions + deletions) × 레포별 보정 계수(문자/줄)로 추정한 값입니다. 보정에 사용한 실제 Diff {{.Org.CalibrationPRs}}건, 평균 {{printf "%.1f" .Org.CharsPerLine}}문자/줄, PR별 보정 오차 {{if ge .Org.CalibrationErrorPct 0.0}}±{{printf "%.1f" .Org.CalibrationErrorPct}}%{{else}}알 수 없음{{end}}.
+  </div>
+  {{end}}
+  {{if .Warnings}}
+  <div class="card" style="border-color:#d32f2f;background:#fdecea">
+    <strong>⛔ 토큰 권한 점검 경고 (Preflight):</strong> 토큰이 조직 전체를 볼 수 없어 아래 수치가 실제보다 적을 수 있습니다.
+    <ul>
+      {{range .Warnings}}<li class="mono">{{.}}</li>{{end}}
+    </ul>
+  </div>
+  {{end}}
+  {{if .OverBudget}}
+  <div class="card" style="border-color:#d32f2f;background:#fdecea">
+    <strong>⛔ 예산 초과 (OVER BUDGET):</strong> 예상 월 비용이 월 예산을 넘습니다. 아래 월 예산 (Monthly Budget) 항목을 확인하세요.
+  </div>
+  {{end}}
+  <div class="sub">분석 기간: {{.Window}}{{if .Filters}} · 필터: {{.Filters}}{{end}} · 생성 시각: {{.GeneratedAt}}</div>
 
   <div class="card">
     <h2>📈 조직 전체 요약 (Organization Summary)</h2>
@@ -341,34 +1388,258 @@ func renderHTMLReport(opts CLIOptions, repos []model.RepoSummary, org model.OrgS
       <div class="metric"><div class="label">월 평균 PR 개수</div><div class="value">{{printf "%.2f" .Org.AvgMonthlyPRs}}</div></div>
       <div class="metric"><div class="label">월 평균 Diff (문자)</div><div class="value mono">{{printf "%.0f" .Org.AvgMonthlyDiffChars}}</div></div>
       <div class="metric"><div class="label">월 평균 Diff (토큰 - 정확한 계산)</div><div class="value mono">{{printf "%d" .Org.AvgMonthlyTokens}}</div></div>
-      <div class="metric"><div class="label">예상 월 비용 (GPT-4o)</div><div class="value">${{printf "%.2f" .Org.CostGPT4oUSD}}</div></div>
-      <div class="metric"><div class="label">예상 월 비용 (Claude 3.5 Sonnet)</div><div class="value">${{printf "%.2f" .Org.CostClaudeSonnetUSD}}</div></div>
+      {{range .Costs}}<div class="metric"><div class="label">예상 월 비용 ({{.Name}})</div><div class="value">${{printf "%.2f" .MonthlyUSD}}</div></div>
+      {{end}}
+      <div class="metric"><div class="label">데이터 완전성</div><div class="value">{{printf "%.1f" .Org.DataCompletenessPct}}%</div></div>
+    </div>
+  </div>
+
+  {{if .Budgets}}
+  <div class="card"{{if .OverBudget}} style="border-color:#d32f2f"{{end}}>
+    <h2>💰 월 예산 (Monthly Budget)</h2>
+    <table>
+      <thead>
+        <tr>
+          <th>모델</th>
+          <th>월 예산</th>
+          <th>예상 월 비용</th>
+          <th>예산 사용률</th>
+          <th>상태</th>
+        </tr>
+      </thead>
+      <tbody>
+        {{range .Budgets}}
+        <tr{{if .Exceeded}} style="background:#fdecea"{{end}}>
+          <td>{{.Model}}</td>
+          <td>${{printf "%.2f" .BudgetUSD}}</td>
+          <td>${{printf "%.2f" .MonthlyUSD}}</td>
+          <td>{{printf "%.1f" .UsedPct}}%</td>
+          <td>{{if .Exceeded}}<strong style="color:#d32f2f">⛔ 초과 (EXCEEDED)</strong>{{else}}✅ 예산 내{{end}}</td>
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+    {{range .Budgets}}{{if .Repos}}
+    <h3>예산 비중이 큰 레포지토리 ({{.Model}})</h3>
+    <table>
+      <thead>
+        <tr>
+          <th>레포지토리</th>
+          <th>예상 월 비용</th>
+          <th>예산 대비</th>
+        </tr>
+      </thead>
+      <tbody>
+        {{range .Repos}}
+        <tr>
+          <td class="mono">{{$.RepoBudgetName .}}</td>
+          <td>${{printf "%.2f" .MonthlyUSD}}</td>
+          <td>{{printf "%.1f" .BudgetPct}}%</td>
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+    {{end}}{{end}}
+  </div>
+  {{end}}
+
+  {{if or .Org.DiffsSkipped .Org.DiffsFailed .Failures}}
+  <div class="card">
+    <h2>⚠️ 누락된 데이터 (Incomplete Data)</h2>
+    <div class="grid">
+      <div class="metric"><div class="label">권한/삭제로 건너뛴 Diff (403/404/410/451)</div><div class="value">{{.Org.DiffsSkipped}}</div></div>
+      <div class="metric"><div class="label">재시도 후 실패한 Diff</div><div class="value">{{.Org.DiffsFailed}}</div></div>
+      <div class="metric"><div class="label">실패한 레포지토리</div><div class="value">{{.Org.ReposFailed}}</div></div>
     </div>
+    {{if .Failures}}
+    <table>
+      <thead>
+        <tr>
+          <th>레포지토리</th>
+          <th>오류</th>
+        </tr>
+      </thead>
+      <tbody>
+        {{range .Failures}}
+        <tr>
+          <td class="mono">{{.RepoName}}</td>
+          <td class="mono">{{.Error}}</td>
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+    {{end}}
+  </div>
+  {{end}}
+
+  {{if .MultiOrg}}
+  <div class="card">
+    <h2>🏢 조직별 소계 (Per-Organization Subtotals)</h2>
+    <table>
+      <thead>
+        <tr>
+          <th>조직</th>
+          <th>레포지토리 수</th>
+          <th>총 PR 수</th>
+          <th>총 Diff (문자)</th>
+          <th>월 평균 토큰</th>
+          {{range $.Costs}}<th>예상 월 비용 ({{.Name}})</th>{{end}}
+        </tr>
+      </thead>
+      <tbody>
+        {{range .OrgTotals}}
+        <tr>
+          <td class="mono">{{.Org}}</td>
+          <td>{{.RepoCount}}</td>
+          <td>{{.TotalPRs}}</td>
+          <td class="mono">{{printf "%d" .TotalDiffChars}}</td>
+          <td class="mono">{{printf "%d" .AvgMonthlyTokens}}</td>
+          {{range .Costs}}<td>${{printf "%.2f" .MonthlyUSD}}</td>{{end}}
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
   </div>
+  {{end}}
 
   <div class="card">
     <h2>📂 레포지토리별 상세 통계 (Per-Repository Stats)</h2>
     <table>
       <thead>
         <tr>
+          {{if .MultiOrg}}<th>조직</th>{{end}}
           <th>레포지토리</th>
           <th>총 PR 수</th>
           <th>총 Diff (문자)</th>
           <th>PR당 평균 Diff (문자)</th>
+          <th>누락 Diff (건너뜀/실패)</th>
+          {{if .Org.Fast}}<th>보정 (문자/줄, 샘플, 오차)</th>{{end}}
         </tr>
       </thead>
       <tbody>
+        {{$multiOrg := .MultiOrg}}
+        {{$fast := .Org.Fast}}
         {{range .Repos}}
         <tr>
+          {{if $multiOrg}}<td class="mono">{{.Org}}</td>{{end}}
           <td class="mono">{{.RepoName}}</td>
           <td>{{.TotalPRs}}</td>
           <td class="mono">{{printf "%d" .TotalDiffChars}}</td>
           <td class="mono">{{printf "%.0f" .AvgDiffCharsPerPR}}</td>
+          <td>{{.DiffsSkipped}} / {{.DiffsFailed}}</td>
+          {{if $fast}}<td class="mono">{{printf "%.1f" .CharsPerLine}} · {{.CalibrationPRs}} · {{if ge .CalibrationErrorPct 0.0}}±{{printf "%.1f" .CalibrationErrorPct}}%{{else}}-{{end}}</td>{{end}}
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+  </div>
+
+  {{if .Excluded}}
+  <div class="card">
+    <h2>🗂️ 제외된 레포지토리 (Excluded Repositories)</h2>
+    <table>
+      <thead>
+        <tr>
+          <th>레포지토리</th>
+          <th>제외 사유</th>
+        </tr>
+      </thead>
+      <tbody>
+        {{range .Excluded}}
+        <tr>
+          <td class="mono">{{.RepoName}}</td>
+          <td>{{.Reason}}</td>
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+  </div>
+  {{end}}
+
+  {{if .Exclusions}}
+  <div class="card">
+    <h2>🚫 제외된 PR (Excluded PRs)</h2>
+    <table>
+      <thead>
+        <tr>
+          <th>제외 규칙</th>
+          <th>제외된 PR 수</th>
+          <th>제외된 Diff (문자)</th>
+        </tr>
+      </thead>
+      <tbody>
+        {{range .Exclusions}}
+        <tr>
+          <td class="mono">{{.Rule}}</td>
+          <td>{{.PRs}}</td>
+          <td class="mono">{{if .Measured}}{{printf "%d" .DiffChars}}{{else}}측정 안 함 (--measure-excluded){{end}}</td>
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+  </div>
+  {{end}}
+
+  {{if .Teams}}
+  <div class="card">
+    <h2>👥 팀별 통계 (Per-Team Breakdown)</h2>
+    <table>
+      <thead>
+        <tr>
+          <th>팀</th>
+          <th>작성자 수</th>
+          <th>총 PR 수</th>
+          <th>총 Diff (문자)</th>
+          <th>월 평균 토큰</th>
+          {{range $.Costs}}<th>예상 월 비용 ({{.Name}})</th>{{end}}
+        </tr>
+      </thead>
+      <tbody>
+        {{range .Teams}}
+        <tr>
+          <td class="mono">{{.Team}}</td>
+          <td>{{.Authors}}</td>
+          <td>{{.TotalPRs}}</td>
+          <td class="mono">{{printf "%d" .TotalDiffChars}}</td>
+          <td class="mono">{{printf "%d" .AvgMonthlyTokens}}</td>
+          {{range .Costs}}<td>${{printf "%.2f" .MonthlyUSD}}</td>{{end}}
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+  </div>
+  {{end}}
+
+  {{if .Authors}}
+  <div class="card">
+    <h2>🧑‍💻 작성자별 통계 (Per-Author Breakdown)</h2>
+    <table>
+      <thead>
+        <tr>
+          <th>작성자</th>
+          {{if .Teams}}<th>팀</th>{{end}}
+          <th>총 PR 수</th>
+          <th>총 Diff (문자)</th>
+          <th>월 평균 토큰</th>
+          {{range $.Costs}}<th>예상 월 비용 ({{.Name}})</th>{{end}}
+        </tr>
+      </thead>
+      <tbody>
+        {{$withTeams := .Teams}}
+        {{range .Authors}}
+        <tr>
+          <td class="mono">{{.Author}}</td>
+          {{if $withTeams}}<td class="mono">{{.Team}}</td>{{end}}
+          <td>{{.TotalPRs}}</td>
+          <td class="mono">{{printf "%d" .TotalDiffChars}}</td>
+          <td class="mono">{{printf "%d" .AvgMonthlyTokens}}</td>
+          {{range .Costs}}<td>${{printf "%.2f" .MonthlyUSD}}</td>{{end}}
         </tr>
         {{end}}
       </tbody>
     </table>
   </div>
+  {{end}}
 
   <div class="sub">본 리포트는 GitHub API와 tiktoken-go 기반 추정치를 사용하여 생성되었습니다.</div>
 </body>
@@ -379,7 +1650,7 @@ func renderHTMLReport(opts CLIOptions, repos []model.RepoSummary, org model.OrgS
 		return err
 	}
 
-	f, err := os.Create(opts.Out)
+	f, err := os.Create(out)
 	if err != nil {
 		return err
 	}
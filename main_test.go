@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	model "pr-agent-cost-estimator/internal/model"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// TestReportRowsUsePricing renders subtotal, author and team rows with custom prices: every cost
+// column is named after a --pricing entry and no default model appears.
+func TestReportRowsUsePricing(t *testing.T) {
+	pricing := []estimator.Price{{Name: "Opus", USDPerM: 15}, {Name: "Mini", USDPerM: 0.5}, {Name: "Local", USDPerM: 0}}
+	costs := estimator.Costs(2000000, pricing)
+	data := reportData{
+		OrgName:   "acme, beta",
+		Costs:     costs,
+		MultiOrg:  true,
+		OrgTotals: []model.OrgSubtotal{{Org: "acme", AvgMonthlyTokens: 2000000, Costs: costs}, {Org: "beta"}},
+		Authors:   []model.AuthorSummary{{Author: "ann", Team: "core", AvgMonthlyTokens: 2000000, Costs: costs}},
+		Teams:     []model.TeamSummary{{Team: "core", Authors: 1, AvgMonthlyTokens: 2000000, Costs: costs}},
+	}
+	out := filepath.Join(t.TempDir(), "report.html")
+	if err := renderHTMLReport(out, data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(b)
+	for _, p := range pricing {
+		// header of the summary metric plus the subtotal, author and team tables
+		if n := strings.Count(html, "예상 월 비용 ("+p.Name+")"); n != 4 {
+			t.Errorf("cost column %q appears %d times, want 4", p.Name, n)
+		}
+	}
+	for _, s := range []string{"GPT-4o", "Claude"} {
+		if strings.Contains(html, s) {
+			t.Errorf("report mentions %s, which is not priced", s)
+		}
+	}
+	if n := strings.Count(html, "<td>$30.00</td>"); n != 3 {
+		t.Errorf("Opus cells = %d, want 3 (subtotal, author, team)", n)
+	}
+
+	if got, want := formatCosts(costs), "est. monthly Opus=$30.00, Mini=$1.00, Local=$0.00"; got != want {
+		t.Errorf("formatCosts = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+
+	metrics "pr-agent-cost-estimator/internal/metrics"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// addEstimateMetrics adds per-org and per-repo gauges for PRs, diff chars, average monthly tokens
+// and estimated monthly cost per price. Orgs for which include returns false are left out; a nil
+// include keeps all of them.
+func addEstimateMetrics(set *metrics.Set, a *estimator.Analysis, include func(org string) bool) {
+	pricing := a.Pricing
+	if len(pricing) == 0 {
+		pricing = estimator.DefaultPricing // analyses written before prices were stored
+	}
+	keep := func(org string) bool { return include == nil || include(org) }
+	org := func(name string, prs int, chars, tokens int64) {
+		if !keep(name) {
+			return
+		}
+		set.Gauge("pr_cost_org_prs", "PRs counted in the analysis window.", float64(prs), "org", name)
+		set.Gauge("pr_cost_org_diff_chars", "Diff characters of the counted PRs.", float64(chars), "org", name)
+		set.Gauge("pr_cost_org_monthly_tokens", "Estimated average monthly input tokens for AI review.", float64(tokens), "org", name)
+		for _, c := range estimator.Costs(tokens, pricing) {
+			set.Gauge("pr_cost_org_monthly_cost_usd", "Estimated average monthly AI review cost in USD per priced model.", c.MonthlyUSD, "org", name, "model", c.Name)
+		}
+	}
+	if len(a.OrgTotals) > 0 {
+		for _, ot := range a.OrgTotals {
+			org(ot.Org, ot.TotalPRs, ot.TotalDiffChars, ot.AvgMonthlyTokens)
+		}
+	} else {
+		org(a.Title, a.Org.TotalPRs, a.Org.TotalDiffChars, a.Org.AvgMonthlyTokens)
+	}
+	for _, r := range a.Repos {
+		owner := r.Org
+		if owner == "" {
+			owner = a.Title
+		}
+		if !keep(owner) {
+			continue
+		}
+		tokens := a.MonthlyTokens(r.TotalDiffChars)
+		set.Gauge("pr_cost_repo_prs", "PRs counted in the analysis window.", float64(r.TotalPRs), "org", owner, "repo", r.RepoName)
+		set.Gauge("pr_cost_repo_diff_chars", "Diff characters of the counted PRs.", float64(r.TotalDiffChars), "org", owner, "repo", r.RepoName)
+		set.Gauge("pr_cost_repo_monthly_tokens", "Estimated average monthly input tokens for AI review.", float64(tokens), "org", owner, "repo", r.RepoName)
+		for _, c := range estimator.Costs(tokens, pricing) {
+			set.Gauge("pr_cost_repo_monthly_cost_usd", "Estimated average monthly AI review cost in USD per priced model.", c.MonthlyUSD, "org", owner, "repo", r.RepoName, "model", c.Name)
+		}
+	}
+}
+
+// analysisOrgs lists the orgs addEstimateMetrics reports for a.
+func analysisOrgs(a *estimator.Analysis) []string {
+	if len(a.OrgTotals) == 0 {
+		return []string{a.Title}
+	}
+	var orgs []string
+	for _, ot := range a.OrgTotals {
+		orgs = append(orgs, ot.Org)
+	}
+	return orgs
+}
+
+// addRunMetrics adds the completeness and collector health of the run behind a, labeled with
+// its target (the report title).
+func addRunMetrics(set *metrics.Set, a *estimator.Analysis) {
+	target := a.Title
+	if strings.TrimSpace(target) == "" {
+		target = "unknown"
+	}
+	set.Gauge("pr_cost_data_completeness_percent", "Share of the data that could be collected (fetched diffs × repos not failed).", a.Org.DataCompletenessPct, "target", target)
+	set.Gauge("pr_cost_repos_failed", "Repositories whose PRs could not be listed.", float64(a.Org.ReposFailed), "target", target)
+	set.Gauge("pr_cost_diffs_failed", "PR diffs that still failed after retries.", float64(a.Org.DiffsFailed), "target", target)
+	set.Gauge("pr_cost_diffs_skipped", "PR diffs skipped for permission or not-found errors.", float64(a.Org.DiffsSkipped), "target", target)
+	if !a.CollectedAt.IsZero() {
+		set.Gauge("pr_cost_collected_timestamp_seconds", "Unix time the data was collected.", float64(a.CollectedAt.Unix()), "target", target)
+	}
+	if c := a.Crawl; c != nil {
+		set.Gauge("pr_cost_crawl_api_calls", "GitHub API calls made by the crawl.", float64(c.APICalls), "target", target)
+		set.Gauge("pr_cost_crawl_rate_limit_waits", "Times the crawl waited for a rate limit to reset.", float64(c.RateLimitWaits), "target", target)
+		set.Gauge("pr_cost_crawl_rate_limit_wait_seconds", "Time the crawl spent waiting for rate limits.", c.RateLimitWaitSeconds, "target", target)
+		set.Gauge("pr_cost_crawl_throttle_wait_seconds", "Time the crawl spent pacing calls (--throttle).", c.ThrottleWaitSeconds, "target", target)
+		if c.RateLimitRemaining >= 0 {
+			set.Gauge("pr_cost_crawl_rate_limit_remaining", "Core rate-limit budget left when the crawl ended.", float64(c.RateLimitRemaining), "target", target)
+		}
+	}
+}
+
+// writeMetricsFile writes the metrics of a for the node_exporter textfile collector.
+func writeMetricsFile(path string, a *estimator.Analysis) error {
+	set := metrics.NewSet()
+	addEstimateMetrics(set, a, nil)
+	addRunMetrics(set, a)
+	return set.WriteFile(path)
+}
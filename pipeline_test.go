@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fakegithub "pr-agent-cost-estimator/internal/fakegithub"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+var update = flag.Bool("update", false, "re-record the replay fixtures in internal/replay/testdata from fakegithub")
+
+// replayFixtures holds the responses of a crawl of pipelineOrg, recorded with -update.
+const replayFixtures = "internal/replay/testdata/acme"
+
+// testPricing prices tokens at $10 per million.
+var testPricing = []estimator.Price{{Name: "Test", USDPerM: 10}}
+
+func init() {
+	// One token per byte keeps token counts exact and the tests offline
+	newTokenizer = func(string) (estimator.Tokenizer, error) {
+		return estimator.TokenizerFunc(func(text string) (int, error) { return len(text), nil }), nil
+	}
+}
+
+// testDiff returns a unified diff adding n lines.
+func testDiff(n int) string {
+	return "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -0,0 +1," + strings.Repeat("+line\n", n)
+}
+
+// pipelineOrg is acme with two repositories over three months of 2024. In api, three diffs are
+// withheld (403, 404, 451), one fails once before succeeding and one fails on every attempt;
+// web's PR list is made to fail by the tests.
+func pipelineOrg() *fakegithub.Org {
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 12, 0, 0, 0, time.UTC) }
+	merged := func(t time.Time) time.Time { return t.Add(24 * time.Hour) }
+	return &fakegithub.Org{Login: "acme", Repos: []*fakegithub.Repo{
+		{Name: "api", Language: "Go", PRs: []*fakegithub.PR{
+			{Number: 1, Title: "Add API", Author: "ann", CreatedAt: day(1, 20), MergedAt: merged(day(1, 20)), Diff: testDiff(100)},
+			{Number: 2, Title: "Secret", Author: "ann", CreatedAt: day(2, 5), MergedAt: merged(day(2, 5)), DiffStatus: http.StatusForbidden},
+			{Number: 3, Title: "Gone", Author: "bob", CreatedAt: day(2, 6), MergedAt: merged(day(2, 6)), DiffStatus: http.StatusNotFound},
+			{Number: 4, Title: "Blocked", Author: "bob", CreatedAt: day(2, 7), MergedAt: merged(day(2, 7)), DiffStatus: http.StatusUnavailableForLegalReasons},
+			{Number: 5, Title: "Flaky", Author: "bob", CreatedAt: day(2, 20), MergedAt: merged(day(2, 20)), Diff: testDiff(50), FailTimes: 1},
+			{Number: 6, Title: "Broken", Author: "ann", CreatedAt: day(3, 1), MergedAt: merged(day(3, 1)), Diff: testDiff(10), FailTimes: 100},
+			{Number: 7, Title: "Bump deps", Author: "dependabot[bot]", Bot: true, CreatedAt: day(3, 15), MergedAt: merged(day(3, 15)), Diff: testDiff(30)},
+		}},
+		{Name: "web", Language: "TypeScript", PRs: []*fakegithub.PR{
+			{Number: 1, Title: "Init", Author: "ann", CreatedAt: day(1, 2), MergedAt: merged(day(1, 2)), Diff: testDiff(40)},
+		}},
+	}}
+}
+
+// pipelineOptions parses crawl flags the way the CLI does, against srv without pacing, cache or
+// progress output, with two attempts per diff.
+func pipelineOptions(t *testing.T, apiURL string, args ...string) CLIOptions {
+	t.Helper()
+	for _, env := range []string{"GITHUB_TOKEN", "GITHUB_APP_ID", "GITHUB_APP_PRIVATE_KEY_FILE"} {
+		t.Setenv(env, "")
+	}
+	var opts CLIOptions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	crawlFlags(fs, &opts)
+	base := []string{"--api-url", apiURL, "--no-cache", "--sleep-min-ms", "0", "--sleep-max-ms", "0", "--retries-nonrate", "2", "--progress", "off", "--github-token", "test-token", "--org", "acme"}
+	if err := fs.Parse(append(base, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// pipelineResult is what a collect → analyze → report run left behind.
+type pipelineResult struct {
+	Analysis *estimator.Analysis
+	JSON     map[string]any // the analysis file, decoded generically
+	HTML     string
+	Output   string // collect output
+}
+
+// runPipeline runs collect, analyze and report as the subcommands do, through the dataset and
+// analysis files.
+func runPipeline(t *testing.T, opts CLIOptions) pipelineResult {
+	t.Helper()
+	dir := t.TempDir()
+	var out bytes.Buffer
+	ds, err := collectDataset(context.Background(), opts, &out)
+	if err != nil {
+		t.Fatalf("collect: %v\n%s", err, out.String())
+	}
+	datasetPath := filepath.Join(dir, "dataset.json")
+	if err := ds.Save(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	if ds, err = estimator.LoadDataset(datasetPath); err != nil {
+		t.Fatal(err)
+	}
+	analysisPath := filepath.Join(dir, "analysis.json")
+	if err := analyzeDataset(ds, "test", testPricing, nil).Save(analysisPath); err != nil {
+		t.Fatal(err)
+	}
+	a, err := estimator.LoadAnalysis(analysisPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(dir, "report.html")
+	writeReport(a, reportPath, nil)
+
+	res := pipelineResult{Analysis: a, Output: out.String()}
+	b, err := os.ReadFile(analysisPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &res.JSON); err != nil {
+		t.Fatal(err)
+	}
+	html, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.HTML = string(html)
+	return res
+}
+
+// jsonPath returns the value at a dotted path of decoded JSON, e.g. "org.totalPRs".
+func jsonPath(v any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// checkPipeline asserts the analysis and report of a crawl of pipelineOrg with web's PR list
+// failing: api's withheld diffs are skipped, the flaky diff is retried, the broken one counts as
+// failed and web is reported as a failed repository.
+func checkPipeline(t *testing.T, res pipelineResult) {
+	t.Helper()
+	a := res.Analysis
+	wantChars := int64(len(testDiff(100)) + len(testDiff(50)) + len(testDiff(30)))
+	for path, want := range map[string]float64{
+		"org.repoCount":      2,
+		"org.totalPRs":       7,
+		"org.totalDiffChars": float64(wantChars),
+		"org.monthsSpan":     3,
+		"org.diffsSkipped":   3,
+		"org.diffsFailed":    1,
+		"org.reposFailed":    1,
+	} {
+		if got := jsonPath(res.JSON, path); got != want {
+			t.Errorf("analysis %s = %v, want %v", path, got, want)
+		}
+	}
+	if got := jsonPath(res.JSON, "org.dataCompletenessPct").(float64); got <= 0 || got >= 100 {
+		t.Errorf("analysis org.dataCompletenessPct = %v, want partial", got)
+	}
+	if a.TokensPerChar != 1 {
+		t.Errorf("tokensPerChar = %v, want 1 from the test tokenizer", a.TokensPerChar)
+	}
+	wantTokens := int64(math.Round(float64(wantChars) / 3))
+	if a.Org.AvgMonthlyTokens != wantTokens {
+		t.Errorf("avg monthly tokens = %d, want %d", a.Org.AvgMonthlyTokens, wantTokens)
+	}
+	if want := estimator.Costs(wantTokens, testPricing); len(a.Costs) != 1 || a.Costs[0] != want[0] {
+		t.Errorf("costs = %+v, want %+v", a.Costs, want)
+	}
+	if len(a.Failures) != 1 || a.Failures[0].RepoName != "web" || !strings.Contains(a.Failures[0].Error, "502") {
+		t.Errorf("failures = %+v, want web with its 502", a.Failures)
+	}
+	authors := map[string]int64{}
+	for _, as := range a.Authors {
+		authors[as.Author] = as.TotalDiffChars
+	}
+	if authors["ann"] != int64(len(testDiff(100))) || authors["bob"] != int64(len(testDiff(50))) || authors["dependabot[bot]"] != int64(len(testDiff(30))) {
+		t.Errorf("authors = %+v", authors)
+	}
+
+	for _, s := range []string{
+		"<td class=\"mono\">api</td>",
+		"예상 월 비용 (Test)",
+		"web",
+		"502",
+		"dependabot[bot]",
+	} {
+		if !strings.Contains(res.HTML, s) {
+			t.Errorf("report lacks %q", s)
+		}
+	}
+}
+
+// TestPipeline crawls fakegithub through the CLI's collect, analyze and report steps while the
+// core rate limit is exhausted at the start and web's PR list fails with 502.
+func TestPipeline(t *testing.T) {
+	srv := fakegithub.New(pipelineOrg())
+	defer srv.Close()
+	srv.Fail("/repos/acme/web/pulls", http.StatusBadGateway, 100)
+	srv.SetRateLimit(0, time.Now().Add(2*time.Second))
+
+	res := runPipeline(t, pipelineOptions(t, srv.URL+"/", "--max-wait-reset", "1m"))
+	checkPipeline(t, res)
+	if c := res.Analysis.Crawl; c == nil || c.RateLimitWaits < 1 || c.RateLimitWaitSeconds <= 0 || c.APICalls == 0 {
+		t.Errorf("crawl stats = %+v, want a rate-limit wait", c)
+	}
+	if !strings.Contains(res.Output, "Discovered 2 repositories in org acme") {
+		t.Errorf("collect output = %q", res.Output)
+	}
+}
+
+// TestPipelineRateLimitCap checks that a reset beyond --max-wait-reset is not waited out: the
+// run ends early with its repositories failed instead of hanging.
+func TestPipelineRateLimitCap(t *testing.T) {
+	srv := fakegithub.New(pipelineOrg())
+	defer srv.Close()
+	srv.SetRateLimit(0, time.Now().Add(time.Hour))
+
+	var out bytes.Buffer
+	start := time.Now()
+	_, err := collectDataset(context.Background(), pipelineOptions(t, srv.URL+"/", "--max-wait-reset", "100ms", "--preflight", "off"), &out)
+	if err == nil || !strings.Contains(err.Error(), "listing repositories") {
+		t.Errorf("collect err = %v, want listing the org to fail", err)
+	}
+	if d := time.Since(start); d > 30*time.Second {
+		t.Errorf("collect took %s despite the wait cap", d)
+	}
+}
+
+// TestPipelineFast runs --fast: diff sizes come from the GraphQL line stats, calibrated on a
+// sample of raw diffs.
+func TestPipelineFast(t *testing.T) {
+	srv := fakegithub.New(pipelineOrg())
+	defer srv.Close()
+
+	res := runPipeline(t, pipelineOptions(t, srv.URL+"/", "--fast", "--calibration-sample", "2"))
+	org := res.Analysis.Org
+	if !org.Fast || org.CalibrationPRs < 2 || org.CharsPerLine <= 0 {
+		t.Errorf("org = %+v, want a calibrated fast estimate", org)
+	}
+	if org.TotalPRs != 8 || org.ReposFailed != 0 {
+		t.Errorf("org = %+v, want all 8 PRs modeled", org)
+	}
+	if got := jsonPath(res.JSON, "fast"); got != true {
+		t.Errorf("analysis fast = %v", got)
+	}
+	if !strings.Contains(res.HTML, "빠른 추정 모드 (--fast)") || !strings.Contains(res.HTML, "보정 (문자/줄, 샘플, 오차)") {
+		t.Error("report does not flag the fast estimate")
+	}
+
+	// A GraphQL page failing with 502 fails its repository, not the run
+	srv.Fail("/graphql", http.StatusBadGateway, 1)
+	res = runPipeline(t, pipelineOptions(t, srv.URL+"/", "--fast", "--calibration-sample", "2"))
+	if f := res.Analysis.Failures; len(f) != 1 || f[0].RepoName != "api" || !strings.Contains(f[0].Error, "502") {
+		t.Errorf("failures = %+v, want api with its 502", f)
+	}
+	if got := jsonPath(res.JSON, "org.totalPRs"); got != 1.0 {
+		t.Errorf("analysis org.totalPRs = %v, want web's PR only", got)
+	}
+}
+
+// TestPipelineDryRun counts PRs with the search API and projects the crawl without fetching
+// diffs.
+func TestPipelineDryRun(t *testing.T) {
+	srv := fakegithub.New(pipelineOrg())
+	defer srv.Close()
+
+	var out bytes.Buffer
+	opts := pipelineOptions(t, srv.URL+"/", "--dry-run", "--since", "2024-02-01", "--until", "2024-02-29")
+	ds, err := collectDataset(context.Background(), opts, &out)
+	if err != nil || ds != nil {
+		t.Fatalf("dry run = %v, %v, want no dataset", ds, err)
+	}
+	for _, s := range []string{
+		" - api: PRs=7, in window=4\n",
+		" - web: PRs=1, in window=0\n",
+		" - PRs: 8 total, 4 in window",
+		"PR list pages: 2, diffs: 4",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("dry-run output lacks %q:\n%s", s, out.String())
+		}
+	}
+}
+
+// TestPipelineGitHubApp authenticates as a GitHub App: the installation on acme is discovered
+// and its token used for the crawl.
+func TestPipelineGitHubApp(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, pemBytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := fakegithub.New(pipelineOrg())
+	defer srv.Close()
+	srv.InstallApp(fakegithub.App{ID: 42, Slug: "cost-estimator", Key: &key.PublicKey})
+	srv.Fail("/repos/acme/web/pulls", http.StatusBadGateway, 100)
+
+	res := runPipeline(t, pipelineOptions(t, srv.URL+"/", "--github-app-id", "42", "--github-app-key", keyFile))
+	if n := srv.InstallationTokens(); n != 1 {
+		t.Errorf("installation tokens minted = %d, want 1", n)
+	}
+	checkPipeline(t, res)
+
+	// A key the server does not know is rejected before anything is crawled
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(other)})
+	if err := os.WriteFile(keyFile, pemBytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := collectDataset(context.Background(), pipelineOptions(t, srv.URL+"/", "--github-app-id", "42", "--github-app-key", keyFile), &out); err == nil {
+		t.Error("collect with a foreign app key succeeded")
+	}
+}
+
+// TestPipelineReplay reruns the pipeline from the checked-in fixtures of a pipelineOrg crawl,
+// without a server. go test -run TestPipelineReplay -update re-records them from fakegithub.
+func TestPipelineReplay(t *testing.T) {
+	if *update {
+		srv := fakegithub.New(pipelineOrg())
+		defer srv.Close()
+		srv.Fail("/repos/acme/web/pulls", http.StatusBadGateway, 100)
+		if err := os.RemoveAll(replayFixtures); err != nil {
+			t.Fatal(err)
+		}
+		runPipeline(t, pipelineOptions(t, srv.URL+"/", "--record", replayFixtures))
+	}
+	checkPipeline(t, runPipeline(t, pipelineOptions(t, "http://replay.invalid/", "--replay", replayFixtures)))
+}
@@ -0,0 +1,106 @@
+package estimator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Budget is a monthly spending limit in USD for one priced model, or for each model when Model
+// is empty.
+type Budget struct {
+	Model string  `json:"model,omitempty"`
+	USD   float64 `json:"usd"`
+}
+
+// BudgetCheck compares one model's projected monthly cost with its budget.
+type BudgetCheck struct {
+	Model      string       `json:"model"`
+	BudgetUSD  float64      `json:"budgetUSD"`
+	MonthlyUSD float64      `json:"monthlyUSD"`
+	UsedPct    float64      `json:"usedPct"`
+	Exceeded   bool         `json:"exceeded"`
+	Repos      []RepoBudget `json:"repos,omitempty"` // repositories above the share threshold, largest first
+}
+
+// RepoBudget is a repository's projected monthly cost as a share of a budget.
+type RepoBudget struct {
+	Org        string  `json:"org,omitempty"`
+	Repo       string  `json:"repo"`
+	MonthlyUSD float64 `json:"monthlyUSD"`
+	BudgetPct  float64 `json:"budgetPct"`
+}
+
+// ParseBudget parses "USD" (a budget for every model) or "Name:USD" (a budget for the price of
+// that name), e.g. "2000" or "GPT-4o:1500". As in ParsePrice, the name may contain colons.
+func ParseBudget(s string) (Budget, error) {
+	name, amount := "", s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		name, amount = strings.TrimSpace(s[:i]), s[i+1:]
+		if name == "" {
+			return Budget{}, fmt.Errorf("budget %q: want USD or NAME:USD", s)
+		}
+	}
+	usd, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+	if err != nil || usd <= 0 {
+		return Budget{}, fmt.Errorf("budget %q: want USD or NAME:USD with a positive number", s)
+	}
+	return Budget{Model: name, USD: usd}, nil
+}
+
+// CheckBudgets compares the projected monthly cost of each priced model with its budget: the
+// budget naming the model (case-insensitively) or else the one without a name. Models without a
+// budget are not checked. Repositories whose projected cost exceeds repoPct percent of the
+// budget are listed in the check; repoPct <= 0 lists none. A budget naming a model that is not
+// priced is an error.
+func (r *Result) CheckBudgets(budgets []Budget, repoPct float64) ([]BudgetCheck, error) {
+	pricing := r.Pricing
+	if len(pricing) == 0 {
+		pricing = DefaultPricing // analyses written before prices were stored
+	}
+	for _, b := range budgets {
+		if b.Model == "" {
+			continue
+		}
+		known := false
+		for _, p := range pricing {
+			known = known || strings.EqualFold(p.Name, b.Model)
+		}
+		if !known {
+			var names []string
+			for _, p := range pricing {
+				names = append(names, p.Name)
+			}
+			return nil, fmt.Errorf("budget for %q: no such price (priced: %s)", b.Model, strings.Join(names, ", "))
+		}
+	}
+
+	orgCosts := Costs(r.Org.AvgMonthlyTokens, pricing)
+	var checks []BudgetCheck
+	for i, p := range pricing {
+		var budget *Budget
+		for j := range budgets {
+			if strings.EqualFold(budgets[j].Model, p.Name) || (budgets[j].Model == "" && budget == nil) {
+				budget = &budgets[j]
+			}
+		}
+		if budget == nil {
+			continue
+		}
+		c := BudgetCheck{Model: p.Name, BudgetUSD: budget.USD, MonthlyUSD: orgCosts[i].MonthlyUSD}
+		c.UsedPct = c.MonthlyUSD / c.BudgetUSD * 100
+		c.Exceeded = c.MonthlyUSD > c.BudgetUSD
+		if repoPct > 0 {
+			for _, rs := range r.Repos {
+				usd := float64(r.MonthlyTokens(rs.TotalDiffChars)) / 1000000.0 * p.USDPerM
+				if share := usd / c.BudgetUSD * 100; share > repoPct {
+					c.Repos = append(c.Repos, RepoBudget{Org: rs.Org, Repo: rs.RepoName, MonthlyUSD: usd, BudgetPct: share})
+				}
+			}
+			sort.SliceStable(c.Repos, func(a, b int) bool { return c.Repos[a].MonthlyUSD > c.Repos[b].MonthlyUSD })
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
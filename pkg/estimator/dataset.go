@@ -0,0 +1,116 @@
+package estimator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	model "pr-agent-cost-estimator/internal/model"
+)
+
+// DatasetVersion is the format version written by Collect; Load rejects other versions.
+const DatasetVersion = 1
+
+// RepoData.Status values. The empty status means the repository was crawled completely.
+const (
+	StatusFailed     = "failed"      // PRs could not be listed; see Error
+	StatusPartial    = "partial"     // crawl interrupted while in this repository
+	StatusNotCrawled = "not-crawled" // crawl interrupted before this repository
+)
+
+// Meta describes how a dataset was collected. It is carried into analyses so a report can be
+// rendered from an analysis alone.
+type Meta struct {
+	Title           string               `json:"title"`
+	Window          string               `json:"window"`
+	Filters         string               `json:"filters,omitempty"`
+	CollectedAt     time.Time            `json:"collectedAt"`
+	Fast            bool                 `json:"fast,omitempty"`
+	MeasureExcluded bool                 `json:"measureExcluded,omitempty"`
+	ExcludedRepos   []model.ExcludedRepo `json:"excludedRepos,omitempty"`
+	Warnings        []string             `json:"warnings,omitempty"`
+	Crawl           *CrawlStats          `json:"crawl,omitempty"` // nil if the collector did not report it
+}
+
+// CrawlStats is the GitHub API activity of the crawl that produced a dataset.
+type CrawlStats struct {
+	APICalls             int64   `json:"apiCalls"`
+	RateLimitWaits       int64   `json:"rateLimitWaits"`
+	RateLimitWaitSeconds float64 `json:"rateLimitWaitSeconds"`
+	ThrottleWaitSeconds  float64 `json:"throttleWaitSeconds"`
+	RateLimitRemaining   int     `json:"rateLimitRemaining"` // core budget left at the end; -1 if unknown
+}
+
+// Dataset is the raw output of Collect: per-PR records for every repository plus the diff
+// sample used for the chars→tokens ratio.
+type Dataset struct {
+	Version int `json:"version"`
+	Meta
+	Owners []string          `json:"owners,omitempty"`
+	Teams  map[string]string `json:"teams,omitempty"` // author login → team
+	Repos  []RepoData        `json:"repos"`
+	Sample string            `json:"sample"`
+}
+
+// RepoData is one repository of a Dataset.
+type RepoData struct {
+	Repo
+	Status      string       `json:"status,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Calibration *Calibration `json:"calibration,omitempty"` // fast mode only
+	PRs         []PRRecord   `json:"prs"`
+}
+
+// Analysis is a stored Analyze result together with the dataset metadata needed to report it.
+type Analysis struct {
+	Meta
+	EncodingModel string `json:"encodingModel,omitempty"`
+	Result
+}
+
+// LoadDataset reads a dataset written by Save.
+func LoadDataset(path string) (*Dataset, error) {
+	var ds Dataset
+	if err := readJSON(path, &ds); err != nil {
+		return nil, err
+	}
+	if ds.Version != DatasetVersion {
+		return nil, fmt.Errorf("%s: unsupported dataset version %d (want %d)", path, ds.Version, DatasetVersion)
+	}
+	return &ds, nil
+}
+
+// Save writes the dataset as JSON.
+func (ds *Dataset) Save(path string) error { return writeJSON(path, ds) }
+
+// LoadAnalysis reads an analysis written by Save.
+func LoadAnalysis(path string) (*Analysis, error) {
+	var a Analysis
+	if err := readJSON(path, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Save writes the analysis as JSON.
+func (a *Analysis) Save(path string) error { return writeJSON(path, a) }
+
+func readJSON(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
@@ -0,0 +1,444 @@
+// Package estimator turns per-repository PR statistics into org-level volume, token and cost
+// estimates. It is the library behind the pr-agent-cost-estimator CLI: callers supply a Source
+// of repository stats, a Tokenizer and pricing, and get a typed Result back. Collect and Analyze
+// split the same work around a storable Dataset, so a crawl can be re-priced without re-crawling.
+package estimator
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	api "pr-agent-cost-estimator/internal/api"
+	model "pr-agent-cost-estimator/internal/model"
+	teams "pr-agent-cost-estimator/internal/teams"
+)
+
+// Stats types produced by sources; aliased so callers outside this module can name them.
+type (
+	RepoStats      = api.RepoStats
+	AuthorStats    = api.AuthorStats
+	ExclusionStats = api.ExclusionStats
+	Calibration    = api.Calibration
+	PRRecord       = api.PRRecord
+)
+
+// PRRecord.Diff values for counted PRs whose diff is missing from DiffChars.
+const (
+	DiffSkipped = api.DiffSkipped // 403/404/410/451
+	DiffFailed  = api.DiffFailed  // retries exhausted
+)
+
+// DefaultSampleBudget bounds the diff text collected across all repos for the chars→tokens ratio.
+const DefaultSampleBudget = 200000
+
+// Repo identifies one repository to estimate. Label is how it appears in failures (e.g. the bare
+// name for a single org, owner/name otherwise).
+type Repo struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// Sample is a bounded buffer of diff text shared by all repos of a run. Sources append to Text
+// and decrement Budget, either through Add or directly (see GitHubSource).
+type Sample struct {
+	Budget int64
+	Text   strings.Builder
+}
+
+// Add appends as much of text as the remaining budget allows.
+func (s *Sample) Add(text string) {
+	if s == nil || s.Budget <= 0 {
+		return
+	}
+	if int64(len(text)) > s.Budget {
+		text = text[:s.Budget]
+	}
+	s.Text.WriteString(text)
+	s.Budget -= int64(len(text))
+}
+
+// Source yields PR statistics for one repository and feeds diff text into sample. Analysis
+// works from the per-PR records in RepoStats.PRs (and Calibration in fast mode); the aggregate
+// fields are not used. If ctx is cancelled it may return partial stats together with ctx.Err().
+type Source interface {
+	RepoStats(ctx context.Context, owner, name string, sample *Sample) (*RepoStats, error)
+}
+
+// Options tune collection and analysis. The zero value is usable.
+type Options struct {
+	// TeamOf maps author logins to teams; team summaries are produced only when it is non-nil.
+	TeamOf map[string]string
+	// Owners lists the owners to report subtotals for, in order. It defaults to the repos'
+	// owners; subtotals are produced only when there is more than one owner.
+	Owners []string
+	// Fast marks the result as a fast-mode estimate whose diff chars are modeled from line
+	// stats; calibration totals are reported even if no repository could be sampled.
+	Fast bool
+	// MeasureExcluded marks exclusion rows as measured (the source fetched excluded diffs).
+	MeasureExcluded bool
+	// SampleBudget bounds the tokenization sample; DefaultSampleBudget if zero.
+	SampleBudget int64
+	// OnRepoStart and OnRepoDone, if set, are called around each repository (e.g. for progress).
+	OnRepoStart func(Repo)
+	OnRepoDone  func(Repo)
+}
+
+// Result is the outcome of Estimate and Analyze.
+type Result struct {
+	Org        model.OrgSummary         `json:"org"`
+	Repos      []model.RepoSummary      `json:"repos"`
+	OrgTotals  []model.OrgSubtotal      `json:"orgTotals,omitempty"` // per-owner subtotals; nil unless several owners
+	Authors    []model.AuthorSummary    `json:"authors"`
+	Teams      []model.TeamSummary      `json:"teams,omitempty"`
+	Exclusions []model.ExclusionSummary `json:"exclusions,omitempty"`
+	Failures   []model.RepoFailure      `json:"failures,omitempty"`
+
+	First         time.Time `json:"firstPRCreatedAt"` // creation time of the first and last counted PR
+	Last          time.Time `json:"lastPRCreatedAt"`
+	TokensPerChar float64   `json:"tokensPerChar"` // measured on the diff sample; 0 if nothing could be tokenized
+	Costs         []Cost    `json:"costs"`         // org monthly cost for each price passed in
+	Pricing       []Price   `json:"pricing,omitempty"`
+}
+
+// MonthlyTokens converts diffChars collected over the result's window into average monthly
+// tokens, the way org, per-org and per-author figures are derived.
+func (r *Result) MonthlyTokens(diffChars int64) int64 {
+	if r.Org.MonthsSpan <= 0 {
+		return 0
+	}
+	return int64(math.Round(r.TokensPerChar * float64(diffChars) / float64(r.Org.MonthsSpan)))
+}
+
+// Estimate collects stats for repos from src and analyzes them in one go; it is Collect
+// followed by Analyze. Cancelling ctx stops the crawl; the partial result is returned with
+// Org.Interrupted set.
+func Estimate(ctx context.Context, src Source, repos []Repo, opts Options, tok Tokenizer, pricing []Price) *Result {
+	return Analyze(Collect(ctx, src, repos, opts), opts, tok, pricing)
+}
+
+// Collect crawls repos from src in order and keeps every PR record, plus a bounded sample of
+// diff text, so the data can be stored and analyzed later with any tokenizer or pricing.
+// Cancelling ctx stops the crawl: the repository in progress keeps its partial records and
+// the remaining ones are marked not crawled.
+func Collect(ctx context.Context, src Source, repos []Repo, opts Options) *Dataset {
+	ds := &Dataset{Version: DatasetVersion, Owners: opts.Owners, Teams: opts.TeamOf}
+	ds.CollectedAt = time.Now().UTC()
+	ds.Fast, ds.MeasureExcluded = opts.Fast, opts.MeasureExcluded
+	sample := &Sample{Budget: opts.SampleBudget}
+	if sample.Budget <= 0 {
+		sample.Budget = DefaultSampleBudget
+	}
+	interrupted := false
+	for _, r := range repos {
+		rd := RepoData{Repo: r}
+		if interrupted || ctx.Err() != nil {
+			interrupted = true
+			rd.Status = StatusNotCrawled
+			ds.Repos = append(ds.Repos, rd)
+			continue
+		}
+		if opts.OnRepoStart != nil {
+			opts.OnRepoStart(r)
+		}
+		stats, err := src.RepoStats(ctx, r.Owner, r.Name, sample)
+		if opts.OnRepoDone != nil {
+			opts.OnRepoDone(r)
+		}
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// interrupted mid-repo: keep what was collected and stop crawling
+			interrupted = true
+			rd.Status = StatusPartial
+			if stats == nil {
+				rd.Status = StatusNotCrawled
+			}
+		case err != nil:
+			slog.Warn("failed to compute diff stats", "repo", r.Label, "err", err)
+			rd.Status, rd.Error = StatusFailed, err.Error()
+		}
+		if stats != nil {
+			rd.PRs, rd.Calibration = stats.PRs, stats.Calibration
+		}
+		ds.Repos = append(ds.Repos, rd)
+	}
+	ds.Sample = sample.Text.String()
+	return ds
+}
+
+// Analyze aggregates a dataset into org, repo, author, team and exclusion summaries with monthly
+// token and cost estimates. Token counts come from tok applied to the dataset's diff sample (a
+// nil tok yields zero tokens). Owners and TeamOf in opts override those stored in ds.
+func Analyze(ds *Dataset, opts Options, tok Tokenizer, pricing []Price) *Result {
+	res := &Result{}
+	authorTotals := map[string]*AuthorStats{}
+	exclusionTotals := map[string]*ExclusionStats{}
+	orgTotals := map[string]*model.OrgSubtotal{}
+	owners, teamOf := opts.Owners, opts.TeamOf
+	if owners == nil {
+		owners = ds.Owners
+	}
+	if teamOf == nil {
+		teamOf = ds.Teams
+	}
+	if owners == nil {
+		seen := map[string]bool{}
+		for _, rd := range ds.Repos {
+			if !seen[rd.Owner] {
+				seen[rd.Owner] = true
+				owners = append(owners, rd.Owner)
+			}
+		}
+	}
+	org := &res.Org
+	// Fast mode calibration totals: pooled sample chars/lines and sample-weighted error
+	var calChars, calLines int64
+	var calErrN int
+	var calErrSum float64
+
+	for _, rd := range ds.Repos {
+		switch rd.Status {
+		case StatusNotCrawled:
+			org.Interrupted = true
+			org.ReposNotCrawled++
+			continue
+		case StatusFailed:
+			res.Failures = append(res.Failures, model.RepoFailure{RepoName: rd.Label, Error: rd.Error})
+			continue
+		case StatusPartial:
+			org.Interrupted = true
+			res.Failures = append(res.Failures, model.RepoFailure{RepoName: rd.Label, Error: "interrupted; partial data included"})
+		}
+		stats := api.StatsFromRecords(rd.PRs, rd.Calibration)
+		for login, a := range stats.ByAuthor {
+			t, ok := authorTotals[login]
+			if !ok {
+				t = &AuthorStats{}
+				authorTotals[login] = t
+			}
+			t.PRs += a.PRs
+			t.DiffChars += a.DiffChars
+		}
+		for rule, ex := range stats.Excluded {
+			t, ok := exclusionTotals[rule]
+			if !ok {
+				t = &ExclusionStats{}
+				exclusionTotals[rule] = t
+			}
+			t.PRs += ex.PRs
+			t.DiffChars += ex.DiffChars
+		}
+		avgPerPR := 0.0
+		if stats.PRCount > 0 {
+			avgPerPR = float64(stats.DiffChars) / float64(stats.PRCount)
+		}
+		rs := model.RepoSummary{
+			Org:               rd.Owner,
+			RepoName:          rd.Name,
+			TotalPRs:          stats.PRCount,
+			TotalDiffChars:    stats.DiffChars,
+			AvgDiffCharsPerPR: avgPerPR,
+			DiffsSkipped:      stats.DiffsSkipped,
+			DiffsFailed:       stats.DiffsFailed,
+		}
+		if cal := stats.Calibration; cal != nil {
+			rs.CharsPerLine, rs.CalibrationPRs, rs.CalibrationErrorPct = cal.CharsPerLine, cal.SamplePRs, cal.ErrorPct
+			org.Fast = true
+			calChars += cal.SampleChars
+			calLines += cal.SampleLines
+			org.CalibrationPRs += cal.SamplePRs
+			if cal.ErrorPct >= 0 {
+				calErrSum += cal.ErrorPct * float64(cal.SamplePRs)
+				calErrN += cal.SamplePRs
+			}
+		}
+		res.Repos = append(res.Repos, rs)
+		org.DiffsSkipped += stats.DiffsSkipped
+		org.DiffsFailed += stats.DiffsFailed
+		org.TotalPRs += stats.PRCount
+		org.TotalDiffChars += stats.DiffChars
+		ot, ok := orgTotals[rd.Owner]
+		if !ok {
+			ot = &model.OrgSubtotal{Org: rd.Owner}
+			orgTotals[rd.Owner] = ot
+		}
+		ot.RepoCount++
+		ot.TotalPRs += stats.PRCount
+		ot.TotalDiffChars += stats.DiffChars
+		if !stats.First.IsZero() && (res.First.IsZero() || stats.First.Before(res.First)) {
+			res.First = stats.First
+		}
+		if !stats.Last.IsZero() && (res.Last.IsZero() || stats.Last.After(res.Last)) {
+			res.Last = stats.Last
+		}
+	}
+	if org.Interrupted {
+		slog.Warn("crawl interrupted", "repos_not_crawled", org.ReposNotCrawled)
+	}
+
+	org.RepoCount = len(ds.Repos)
+	org.MonthsSpan = MonthsSpan(res.First, res.Last)
+	if org.MonthsSpan > 0 {
+		org.AvgMonthlyPRs = float64(org.TotalPRs) / float64(org.MonthsSpan)
+		org.AvgMonthlyDiffChars = float64(org.TotalDiffChars) / float64(org.MonthsSpan)
+	}
+	if org.AvgMonthlyDiffChars > 0 {
+		res.TokensPerChar = tokensPerChar(tok, ds.Sample)
+		org.AvgMonthlyTokens = int64(math.Round(res.TokensPerChar * org.AvgMonthlyDiffChars))
+	}
+	res.Costs = Costs(org.AvgMonthlyTokens, pricing)
+	res.Pricing = pricing
+	org.ReposFailed = len(res.Failures)
+	org.DataCompletenessPct = DataCompleteness(org.TotalPRs, org.DiffsSkipped+org.DiffsFailed, len(ds.Repos), len(res.Failures)+org.ReposNotCrawled)
+	if ds.Fast || opts.Fast || org.Fast {
+		org.Fast = true
+		org.CharsPerLine, org.CalibrationErrorPct = api.DefaultCharsPerLine, -1
+		if calLines > 0 {
+			org.CharsPerLine = float64(calChars) / float64(calLines)
+		}
+		if calErrN > 0 {
+			org.CalibrationErrorPct = calErrSum / float64(calErrN)
+		}
+	}
+
+	res.Authors, res.Teams = summarizeAuthors(authorTotals, teamOf, org.MonthsSpan, res.TokensPerChar, pricing)
+	res.Exclusions = summarizeExclusions(exclusionTotals, ds.MeasureExcluded || opts.MeasureExcluded)
+	if len(owners) > 1 {
+		for _, owner := range owners {
+			ot, ok := orgTotals[owner]
+			if !ok {
+				ot = &model.OrgSubtotal{Org: owner}
+			}
+			if org.MonthsSpan > 0 {
+				ot.AvgMonthlyTokens = int64(math.Round(res.TokensPerChar * float64(ot.TotalDiffChars) / float64(org.MonthsSpan)))
+			}
+			ot.Costs = Costs(ot.AvgMonthlyTokens, pricing)
+			res.OrgTotals = append(res.OrgTotals, *ot)
+		}
+	}
+	return res
+}
+
+// tokensPerChar measures the chars→tokens ratio of sample with tok; 0 if that is not possible.
+func tokensPerChar(tok Tokenizer, sample string) float64 {
+	if tok == nil || len(sample) == 0 {
+		return 0
+	}
+	n, err := tok.CountTokens(sample)
+	if err != nil {
+		slog.Warn("tokenization failed; token and cost estimates will be zero", "err", err)
+		return 0
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(n) / float64(len(sample))
+}
+
+// MonthsSpan returns the number of months between first and last, counting a partial
+// trailing month and never less than 1; 0 if either time is unset.
+func MonthsSpan(first, last time.Time) int {
+	if first.IsZero() || last.IsZero() {
+		return 0
+	}
+	y1, m1, d1 := first.Date()
+	y2, m2, d2 := last.Date()
+	months := (y2-y1)*12 + int(m2-m1)
+	if d2 < d1 {
+		months++ // include partial month at the end if day hasn't reached
+	}
+	if months < 1 {
+		months = 1
+	}
+	return months
+}
+
+// DataCompleteness returns the share of data actually collected, in percent: the fraction of
+// counted PRs whose diff was fetched, scaled by the fraction of repos that did not fail outright.
+func DataCompleteness(prs, missingDiffs, repos, failedRepos int) float64 {
+	pct := 100.0
+	if prs > 0 {
+		pct *= float64(prs-missingDiffs) / float64(prs)
+	}
+	if repos > 0 {
+		pct *= float64(repos-failedRepos) / float64(repos)
+	}
+	return pct
+}
+
+// summarizeAuthors converts per-author totals into monthly token/cost estimates using the org-wide
+// months span and chars->tokens ratio, priced with pricing. Team summaries are only produced when teamOf is non-nil.
+// Both slices are sorted by total diff chars, descending.
+func summarizeAuthors(totals map[string]*AuthorStats, teamOf map[string]string, monthsSpan int, tokensPerChar float64, pricing []Price) ([]model.AuthorSummary, []model.TeamSummary) {
+	monthlyTokens := func(chars int64) int64 {
+		if monthsSpan <= 0 {
+			return 0
+		}
+		return int64(math.Round(tokensPerChar * float64(chars) / float64(monthsSpan)))
+	}
+	var authors []model.AuthorSummary
+	byTeam := map[string]*model.TeamSummary{}
+	for login, a := range totals {
+		as := model.AuthorSummary{
+			Author:           login,
+			TotalPRs:         a.PRs,
+			TotalDiffChars:   a.DiffChars,
+			AvgMonthlyTokens: monthlyTokens(a.DiffChars),
+		}
+		as.Costs = Costs(as.AvgMonthlyTokens, pricing)
+		if teamOf != nil {
+			as.Team = teamOf[login]
+			if as.Team == "" {
+				as.Team = teams.Unassigned
+			}
+			ts, ok := byTeam[as.Team]
+			if !ok {
+				ts = &model.TeamSummary{Team: as.Team}
+				byTeam[as.Team] = ts
+			}
+			ts.Authors++
+			ts.TotalPRs += a.PRs
+			ts.TotalDiffChars += a.DiffChars
+		}
+		authors = append(authors, as)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].TotalDiffChars != authors[j].TotalDiffChars {
+			return authors[i].TotalDiffChars > authors[j].TotalDiffChars
+		}
+		return authors[i].Author < authors[j].Author
+	})
+
+	var teamRows []model.TeamSummary
+	for _, ts := range byTeam {
+		ts.AvgMonthlyTokens = monthlyTokens(ts.TotalDiffChars)
+		ts.Costs = Costs(ts.AvgMonthlyTokens, pricing)
+		teamRows = append(teamRows, *ts)
+	}
+	sort.Slice(teamRows, func(i, j int) bool {
+		if teamRows[i].TotalDiffChars != teamRows[j].TotalDiffChars {
+			return teamRows[i].TotalDiffChars > teamRows[j].TotalDiffChars
+		}
+		return teamRows[i].Team < teamRows[j].Team
+	})
+	return authors, teamRows
+}
+
+// summarizeExclusions flattens per-rule exclusion totals, sorted by PR count descending.
+func summarizeExclusions(totals map[string]*ExclusionStats, measured bool) []model.ExclusionSummary {
+	var out []model.ExclusionSummary
+	for rule, ex := range totals {
+		out = append(out, model.ExclusionSummary{Rule: rule, PRs: ex.PRs, DiffChars: ex.DiffChars, Measured: measured})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].PRs != out[j].PRs {
+			return out[i].PRs > out[j].PRs
+		}
+		return out[i].Rule < out[j].Rule
+	})
+	return out
+}
@@ -0,0 +1,223 @@
+package estimator
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+	api "pr-agent-cost-estimator/internal/api"
+	fakegithub "pr-agent-cost-estimator/internal/fakegithub"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// quarterTokenizer counts one token per four chars, a stand-in for tiktoken that needs no download.
+var quarterTokenizer = TokenizerFunc(func(s string) (int, error) { return len(s) / 4, nil })
+
+// mapSource serves fixed stats per "owner/name" and feeds 400 chars into the sample.
+type mapSource map[string]*RepoStats
+
+func (m mapSource) RepoStats(ctx context.Context, owner, name string, sample *Sample) (*RepoStats, error) {
+	sample.Add(strings.Repeat("abcd", 100))
+	return m[owner+"/"+name], nil
+}
+
+func TestMonthsSpan(t *testing.T) {
+	tests := []struct {
+		name        string
+		first, last time.Time
+		want        int
+	}{
+		{"same day", day("2024-03-10"), day("2024-03-10"), 1},
+		{"same month", day("2024-03-01"), day("2024-03-31"), 1},
+		{"next month before day reached", day("2024-01-31"), day("2024-02-01"), 2},
+		{"whole months", day("2024-01-15"), day("2024-04-15"), 3},
+		{"partial trailing month", day("2024-01-15"), day("2024-04-14"), 4},
+		{"year boundary", day("2023-12-15"), day("2024-01-15"), 1},
+		{"year boundary partial", day("2023-12-20"), day("2024-01-05"), 2},
+		{"several years", day("2022-06-01"), day("2024-06-01"), 24},
+		{"zero first", time.Time{}, day("2024-01-01"), 0},
+		{"zero last", day("2024-01-01"), time.Time{}, 0},
+		{"inverted", day("2024-05-01"), day("2024-01-01"), 1},
+	}
+	for _, tt := range tests {
+		if got := MonthsSpan(tt.first, tt.last); got != tt.want {
+			t.Errorf("%s: MonthsSpan(%s, %s) = %d, want %d", tt.name, tt.first.Format("2006-01-02"), tt.last.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Price
+		wantErr bool
+	}{
+		{in: "GPT-4o:5", want: Price{Name: "GPT-4o", USDPerM: 5}},
+		{in: " Opus : 15.5 ", want: Price{Name: "Opus", USDPerM: 15.5}},
+		{in: "vendor:model:0.25", want: Price{Name: "vendor:model", USDPerM: 0.25}},
+		{in: "Free:0", want: Price{Name: "Free", USDPerM: 0}},
+		{in: "GPT-4o", wantErr: true},
+		{in: ":5", wantErr: true},
+		{in: "GPT-4o:", wantErr: true},
+		{in: "GPT-4o:-1", wantErr: true},
+		{in: "GPT-4o:five", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePrice(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePrice(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParsePrice(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCosts(t *testing.T) {
+	pricing := []Price{{Name: "Opus", USDPerM: 15}, {Name: "Mini", USDPerM: 0.15}}
+	got := Costs(2000000, pricing)
+	want := []Cost{{Name: "Opus", MonthlyUSD: 30}, {Name: "Mini", MonthlyUSD: 0.3}}
+	if len(got) != len(want) {
+		t.Fatalf("Costs = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || math.Abs(got[i].MonthlyUSD-want[i].MonthlyUSD) > 1e-9 {
+			t.Errorf("Costs[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	for _, c := range Costs(0, pricing) {
+		if c.MonthlyUSD != 0 {
+			t.Errorf("Costs(0) %s = %v, want 0", c.Name, c.MonthlyUSD)
+		}
+	}
+	if got := Costs(1000, nil); len(got) != 0 {
+		t.Errorf("Costs without pricing = %+v, want none", got)
+	}
+}
+
+// TestAnalyzePricing checks that every cost in the result, down to authors, teams and per-org
+// subtotals, uses the caller's prices.
+func TestAnalyzePricing(t *testing.T) {
+	src := mapSource{
+		"a/x": {PRs: []api.PRRecord{
+			{Number: 1, Author: "ann", CreatedAt: day("2024-01-01"), DiffChars: 1000},
+			{Number: 2, Author: "ann", CreatedAt: day("2024-02-15"), DiffChars: 3000},
+			{Number: 3, Author: "bot", CreatedAt: day("2024-02-15"), Excluded: "bots"},
+		}},
+		"b/y": {PRs: []api.PRRecord{
+			{Number: 1, Author: "bob", CreatedAt: day("2024-01-10"), DiffChars: 1000, Diff: api.DiffSkipped},
+			{Number: 2, Author: "bob", CreatedAt: day("2024-03-01"), DiffChars: 1000},
+		}},
+	}
+	repos := []Repo{{Owner: "a", Name: "x", Label: "a/x"}, {Owner: "b", Name: "y", Label: "b/y"}}
+	pricing := []Price{{Name: "Opus", USDPerM: 15}, {Name: "Mini", USDPerM: 0.5}}
+	opts := Options{TeamOf: map[string]string{"ann": "core"}}
+	res := Estimate(context.Background(), src, repos, opts, quarterTokenizer, pricing)
+
+	// 6000 chars over Jan 1 – Mar 1 (2 months) at 0.25 tokens/char
+	if res.Org.MonthsSpan != 2 || res.Org.AvgMonthlyTokens != 750 {
+		t.Fatalf("org = %+v, want 2 months and 750 tokens/month", res.Org)
+	}
+	checkCosts := func(what string, got []Cost, tokens int64) {
+		t.Helper()
+		want := Costs(tokens, pricing)
+		if len(got) != len(want) {
+			t.Errorf("%s costs = %+v, want %+v", what, got, want)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s costs = %+v, want %+v", what, got, want)
+				return
+			}
+		}
+	}
+	checkCosts("org", res.Costs, 750)
+	if len(res.OrgTotals) != 2 {
+		t.Fatalf("org totals = %+v, want a and b", res.OrgTotals)
+	}
+	for _, ot := range res.OrgTotals {
+		checkCosts("org "+ot.Org, ot.Costs, ot.AvgMonthlyTokens)
+	}
+	if res.OrgTotals[0].AvgMonthlyTokens != 500 || res.OrgTotals[1].AvgMonthlyTokens != 250 {
+		t.Errorf("org subtotal tokens = %d, %d, want 500, 250", res.OrgTotals[0].AvgMonthlyTokens, res.OrgTotals[1].AvgMonthlyTokens)
+	}
+	if len(res.Authors) != 2 || res.Authors[0].Author != "ann" {
+		t.Fatalf("authors = %+v, want ann then bob", res.Authors)
+	}
+	for _, as := range res.Authors {
+		checkCosts("author "+as.Author, as.Costs, as.AvgMonthlyTokens)
+	}
+	if len(res.Teams) != 2 {
+		t.Fatalf("teams = %+v, want core and unassigned", res.Teams)
+	}
+	for _, ts := range res.Teams {
+		checkCosts("team "+ts.Team, ts.Costs, ts.AvgMonthlyTokens)
+	}
+	if res.Org.DiffsSkipped != 1 || len(res.Exclusions) != 1 || res.Exclusions[0].Rule != "bots" {
+		t.Errorf("completeness/exclusions = %+v %+v", res.Org, res.Exclusions)
+	}
+
+	// The same dataset re-priced gives new costs without re-crawling
+	ds := Collect(context.Background(), src, repos, opts)
+	cheap := []Price{{Name: "Cheap", USDPerM: 1}}
+	again := Analyze(ds, opts, quarterTokenizer, cheap)
+	if len(again.Costs) != 1 || again.Costs[0].Name != "Cheap" || again.Authors[0].Costs[0].Name != "Cheap" {
+		t.Errorf("re-priced costs = %+v / %+v, want Cheap only", again.Costs, again.Authors[0].Costs)
+	}
+}
+
+// TestGitHubSourceWindow checks that --since/--until bound the PRs a crawl counts and the months
+// span derived from them: the bounds are inclusive instants.
+func TestGitHubSourceWindow(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	var prs []*fakegithub.PR
+	for i, created := range []string{
+		"2023-12-31T23:59:59Z", // before since
+		"2024-01-01T00:00:00Z", // exactly since
+		"2024-02-10T12:00:00Z",
+		"2024-03-31T23:59:59Z", // exactly until
+		"2024-04-01T00:00:00Z", // after until
+	} {
+		prs = append(prs, &fakegithub.PR{Number: i + 1, Author: "dev", CreatedAt: at(created), MergedAt: at(created).Add(time.Hour), Diff: strings.Repeat("+x\n", 100)})
+	}
+	srv := fakegithub.New(&fakegithub.Org{Login: "acme", Repos: []*fakegithub.Repo{{Name: "api", PRs: prs}}})
+	defer srv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	since, until := at("2024-01-01T00:00:00Z"), at("2024-03-31T23:59:59Z")
+	src := &GitHubSource{Collector: api.NewCollector(client, api.DefaultPolicy), Since: &since, Until: &until}
+	res := Estimate(context.Background(), src, []Repo{{Owner: "acme", Name: "api", Label: "api"}}, Options{}, quarterTokenizer, DefaultPricing)
+
+	if res.Org.TotalPRs != 3 {
+		t.Errorf("PRs in window = %d, want 3", res.Org.TotalPRs)
+	}
+	if !res.First.Equal(since) || !res.Last.Equal(until) {
+		t.Errorf("first/last = %s/%s, want %s/%s", res.First, res.Last, since, until)
+	}
+	if want := MonthsSpan(since, until); res.Org.MonthsSpan != want {
+		t.Errorf("months span = %d, want %d", res.Org.MonthsSpan, want)
+	}
+	if res.Org.TotalDiffChars != 3*300 {
+		t.Errorf("diff chars = %d, want %d", res.Org.TotalDiffChars, 3*300)
+	}
+}
@@ -0,0 +1,54 @@
+package estimator_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	fakegithub "pr-agent-cost-estimator/internal/fakegithub"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// TestExternalGitHubSource builds a GitHubSource the way a program importing the package must,
+// naming only estimator's exported identifiers, and reads its PR records back from the dataset.
+func TestExternalGitHubSource(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	srv := fakegithub.New(&fakegithub.Org{Login: "acme", Repos: []*fakegithub.Repo{{Name: "api", PRs: []*fakegithub.PR{
+		{Number: 1, Author: "ann", CreatedAt: created, MergedAt: created.Add(time.Hour), Diff: "+a\n+b\n"},
+		{Number: 2, Author: "bob", CreatedAt: created, MergedAt: created.Add(time.Hour), Head: "renovate/go", Diff: "+c\n"},
+		{Number: 3, Author: "ann", CreatedAt: created, MergedAt: created.Add(time.Hour), DiffStatus: http.StatusNotFound},
+	}}}})
+	defer srv.Close()
+
+	client := estimator.NewGitHubClient(context.Background(), "test-token", nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	policy := estimator.DefaultPolicy
+	policy.RetriesNonRate = 2
+	var src estimator.Source = &estimator.GitHubSource{
+		Collector: estimator.NewCollector(client, policy),
+		Filter:    &estimator.PRFilter{MergedOnly: true, HeadBranches: estimator.Globs([]string{"renovate/*"}, false)},
+	}
+	ds := estimator.Collect(context.Background(), src, []estimator.Repo{{Owner: "acme", Name: "api", Label: "api"}}, estimator.Options{})
+
+	var records []estimator.PRRecord = ds.Repos[0].PRs
+	want := map[int]estimator.PRRecord{
+		1: {Number: 1, Author: "ann", DiffChars: 6},
+		2: {Number: 2, Author: "bob", Excluded: "head:renovate/*"},
+		3: {Number: 3, Author: "ann", Diff: estimator.DiffSkipped},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %+v, want %d", records, len(want))
+	}
+	for _, r := range records {
+		w := want[r.Number]
+		if r.Author != w.Author || r.DiffChars != w.DiffChars || r.Excluded != w.Excluded || r.Diff != w.Diff {
+			t.Errorf("PR %d = %+v, want %+v", r.Number, r, w)
+		}
+	}
+	var stats estimator.CallStats = src.(*estimator.GitHubSource).Collector.Snapshot()
+	if stats.APICalls == 0 {
+		t.Errorf("collector stats = %+v, want API calls", stats)
+	}
+}
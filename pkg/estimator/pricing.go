@@ -0,0 +1,52 @@
+package estimator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	model "pr-agent-cost-estimator/internal/model"
+)
+
+// Price is a model's input price in USD per million tokens.
+type Price struct {
+	Name    string  `json:"name"`
+	USDPerM float64 `json:"usdPerM"`
+}
+
+// Cost is the estimated monthly spend for one price; aliased so summary rows can carry costs.
+type Cost = model.Cost
+
+// DefaultPricing holds the PRD prices used for the report's cost columns.
+var DefaultPricing = []Price{
+	{Name: "GPT-4o", USDPerM: 5.0},
+	{Name: "Claude 3.5 Sonnet", USDPerM: 3.0},
+}
+
+// Costs prices monthlyTokens with each entry of pricing, in order.
+func Costs(monthlyTokens int64, pricing []Price) []Cost {
+	out := make([]Cost, 0, len(pricing))
+	for _, p := range pricing {
+		c := Cost{Name: p.Name}
+		if monthlyTokens > 0 {
+			c.MonthlyUSD = float64(monthlyTokens) / 1000000.0 * p.USDPerM
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// ParsePrice parses "Name:USD" where USD is the price per million input tokens, e.g. "GPT-4o:5".
+// The name may itself contain colons; the price follows the last one.
+func ParsePrice(s string) (Price, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return Price{}, fmt.Errorf("price %q: want NAME:USD_PER_1M_TOKENS", s)
+	}
+	name := strings.TrimSpace(s[:i])
+	usd, err := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+	if name == "" || err != nil || usd < 0 {
+		return Price{}, fmt.Errorf("price %q: want NAME:USD_PER_1M_TOKENS with a non-negative number", s)
+	}
+	return Price{Name: name, USDPerM: usd}, nil
+}
@@ -0,0 +1,63 @@
+package estimator
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	github "github.com/google/go-github/v61/github"
+	api "pr-agent-cost-estimator/internal/api"
+)
+
+// Crawl types behind GitHubSource; aliased so callers outside this module can build one.
+type (
+	// Collector crawls GitHub with one client and Policy; create it with NewCollector.
+	Collector = api.Collector
+	// Policy sets a Collector's pacing, retries and rate-limit waits.
+	Policy = api.Policy
+	// PRFilter selects the PRs a crawl counts; excluded ones are reported per rule.
+	PRFilter = api.PRFilter
+	// Glob is a branch or login pattern of a PRFilter, built with Globs.
+	Glob = api.Glob
+	// CallStats is a snapshot of a Collector's API activity.
+	CallStats = api.CallStats
+)
+
+// DefaultPolicy does not pace calls, tries each diff once and waits at most two minutes for a
+// rate-limit reset.
+var DefaultPolicy = api.DefaultPolicy
+
+// NewCollector returns a collector crawling through client with policy p.
+func NewCollector(client *github.Client, p Policy) *Collector {
+	return api.NewCollector(client, p)
+}
+
+// NewGitHubClient returns a client authenticated with token (unauthenticated if empty) over
+// base, or http.DefaultTransport if base is nil. Set its BaseURL for GitHub Enterprise.
+func NewGitHubClient(ctx context.Context, token string, base http.RoundTripper) *github.Client {
+	return api.NewGitHubClient(ctx, token, base)
+}
+
+// Globs compiles shell-style patterns ("renovate/*") for a PRFilter, ignoring case if foldCase.
+func Globs(patterns []string, foldCase bool) []Glob {
+	return api.Globs(patterns, foldCase)
+}
+
+// GitHubSource reads repository stats from GitHub through a Collector: exact diff sizes by
+// default, or line-stat estimates with calibration diffs when Fast is set.
+type GitHubSource struct {
+	Collector    *Collector
+	Since, Until *time.Time
+	Filter       *PRFilter
+	Fast         bool
+	// CalibrationPRs is the number of diffs sampled per repository in fast mode.
+	CalibrationPRs int
+}
+
+// RepoStats implements Source.
+func (s *GitHubSource) RepoStats(ctx context.Context, owner, name string, sample *Sample) (*RepoStats, error) {
+	if s.Fast {
+		return s.Collector.RepoPRLineStats(ctx, owner, name, s.Since, s.Until, s.Filter, s.CalibrationPRs, &sample.Budget, &sample.Text)
+	}
+	return s.Collector.RepoPRDiffStats(ctx, owner, name, s.Since, s.Until, s.Filter, &sample.Budget, &sample.Text)
+}
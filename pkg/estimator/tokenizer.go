@@ -0,0 +1,39 @@
+package estimator
+
+import (
+	"fmt"
+
+	tiktoken "github.com/pkoukk/tiktoken-go"
+)
+
+// Tokenizer counts the tokens a model would see for text.
+type Tokenizer interface {
+	CountTokens(text string) (int, error)
+}
+
+// TokenizerFunc adapts a plain function to Tokenizer.
+type TokenizerFunc func(text string) (int, error)
+
+// CountTokens implements Tokenizer.
+func (f TokenizerFunc) CountTokens(text string) (int, error) { return f(text) }
+
+// NewTiktoken returns a tiktoken tokenizer for model, which may also name an encoding such as
+// o200k_base, falling back to cl100k_base if neither is known. Encodings are downloaded on
+// first use, so this fails without network access to the BPE files unless they are cached
+// (see TIKTOKEN_CACHE_DIR).
+func NewTiktoken(model string) (Tokenizer, error) {
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil || enc == nil {
+		enc, err = tiktoken.GetEncoding(model)
+	}
+	if err != nil || enc == nil {
+		// Fallback to cl100k_base if model-specific encoding is not found
+		enc, err = tiktoken.GetEncoding("cl100k_base")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load tiktoken encoding for %s: %w", model, err)
+	}
+	return TokenizerFunc(func(text string) (int, error) {
+		return len(enc.Encode(text, nil, nil)), nil
+	}), nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	github "github.com/google/go-github/v61/github"
+	api "pr-agent-cost-estimator/internal/api"
+	ghapp "pr-agent-cost-estimator/internal/ghapp"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// prCommentMarker is the hidden HTML comment that identifies the sticky comment pr --comment
+// keeps up to date.
+const prCommentMarker = "<!-- pr-agent-cost-estimator -->"
+
+// prEstimate is what reviewing one pull request's diff would cost with each configured price.
+type prEstimate struct {
+	Repo          string
+	Number        int
+	Title         string
+	Author        string
+	Excluded      string // filter rule that excludes the PR from estimates, "" if it counts
+	DiffChars     int
+	Tokens        int
+	EncodingModel string
+	Costs         []prCost
+}
+
+// prCost is the cost of one review of the diff at one model's input price.
+type prCost struct {
+	Name    string
+	USDPerM float64
+	USD     float64
+}
+
+// runPR implements "pr": estimate the tokens and cost of a single pull request, given as an
+// argument or taken from the GitHub Actions event, and optionally keep a sticky comment on it.
+func runPR(args []string) {
+	fs := flag.NewFlagSet("pr", flag.ExitOnError)
+	var opts CLIOptions
+	var encodingModel string
+	var prices stringList
+	var comment bool
+	authFlags(fs, &opts)
+	prFilterFlags(fs, &opts)
+	analysisFlags(fs, &encodingModel, &prices)
+	fs.IntVar(&opts.RetriesNonRate, "retries-nonrate", 10, "Retry attempts for non-rate-limit transient errors")
+	fs.StringVar(&opts.LogLevel, "log-level", "info", "Diagnostic log level: debug, info, warn or error")
+	fs.StringVar(&opts.LogFormat, "log-format", "text", "Diagnostic log format on stderr: text or json")
+	fs.BoolVar(&comment, "comment", false, "Post the estimate as a PR comment, updating the previous one instead of adding another")
+	configFlags(fs, &opts.Config, &opts.Profile)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s pr [flags] [OWNER/REPO/NUMBER | OWNER/REPO#NUMBER | OWNER/REPO NUMBER]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Without an argument the pull request is read from the GitHub Actions event in GITHUB_EVENT_PATH.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	opts.Origins = applyConfig(fs, opts.Config, opts.Profile)
+	setupLogger(opts.LogLevel, opts.LogFormat)
+	pricing := parsePricing(prices)
+
+	var owner, repo string
+	var number int
+	var err error
+	if fs.NArg() > 0 {
+		owner, repo, number, err = parsePRRef(fs.Args())
+	} else if path := os.Getenv("GITHUB_EVENT_PATH"); path != "" {
+		owner, repo, number, err = prFromEvent(path)
+	} else {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if err != nil {
+		slog.Error("invalid pull request", "err", err)
+		os.Exit(exitUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	est, collector, err := estimatePR(ctx, opts, owner, repo, number, encodingModel, pricing)
+	if err == nil {
+		printPREstimate(os.Stdout, est)
+		if comment {
+			var cm *github.IssueComment
+			var created bool
+			author, cerr := commentAuthor(ctx, opts, collector)
+			if cerr == nil {
+				cm, created, cerr = collector.UpsertComment(ctx, owner, repo, number, author, prCommentMarker, prCommentBody(est))
+			}
+			switch {
+			case cerr != nil:
+				err = fail(authOr(cerr, exitError), "writing PR comment", "err", cerr)
+			case created:
+				fmt.Printf("Comment posted: %s\n", cm.GetHTMLURL())
+			default:
+				fmt.Printf("Comment updated: %s\n", cm.GetHTMLURL())
+			}
+		}
+	}
+	var re *runError
+	switch {
+	case errors.As(err, &re):
+		slog.Error(re.msg, re.args...)
+		os.Exit(re.code)
+	case err != nil:
+		slog.Error("pr failed", "err", err)
+		os.Exit(exitError)
+	}
+}
+
+// parsePRRef parses OWNER/REPO/NUMBER, OWNER/REPO#NUMBER or the two arguments OWNER/REPO NUMBER.
+func parsePRRef(args []string) (owner, repo string, number int, err error) {
+	var full, num string
+	switch len(args) {
+	case 1:
+		i := strings.LastIndexAny(args[0], "/#")
+		if i < 0 {
+			return "", "", 0, fmt.Errorf("%q: want OWNER/REPO/NUMBER or OWNER/REPO#NUMBER", args[0])
+		}
+		full, num = args[0][:i], args[0][i+1:]
+	case 2:
+		full, num = args[0], args[1]
+	default:
+		return "", "", 0, fmt.Errorf("want one pull request, got %d arguments", len(args))
+	}
+	owner, repo, ok := strings.Cut(full, "/")
+	number, nerr := strconv.Atoi(num)
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") || nerr != nil || number <= 0 {
+		return "", "", 0, fmt.Errorf("%q: want OWNER/REPO/NUMBER, OWNER/REPO#NUMBER or OWNER/REPO NUMBER", strings.Join(args, " "))
+	}
+	return owner, repo, number, nil
+}
+
+// prFromEvent reads the pull request from a GitHub Actions event payload: pull_request and
+// pull_request_target events, or an issue_comment event on a pull request.
+func prFromEvent(path string) (owner, repo string, number int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("GITHUB_EVENT_PATH: %w", err)
+	}
+	var ev struct {
+		PullRequest *struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+		Issue *struct {
+			Number      int             `json:"number"`
+			PullRequest json.RawMessage `json:"pull_request"`
+		} `json:"issue"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return "", "", 0, fmt.Errorf("GITHUB_EVENT_PATH %s: %w", path, err)
+	}
+	switch {
+	case ev.PullRequest != nil:
+		number = ev.PullRequest.Number
+	case ev.Issue != nil && len(ev.Issue.PullRequest) > 0 && string(ev.Issue.PullRequest) != "null":
+		number = ev.Issue.Number
+	default:
+		return "", "", 0, fmt.Errorf("GITHUB_EVENT_PATH %s: not a pull_request or pull request comment event", path)
+	}
+	return parsePRRef([]string{ev.Repository.FullName, strconv.Itoa(number)})
+}
+
+// estimatePR fetches the pull request, applies the PR filters and, unless it is excluded,
+// tokenizes its diff and prices one review with each price. It also returns the collector so
+// the caller can write the comment with the same client.
+func estimatePR(ctx context.Context, opts CLIOptions, owner, repo string, number int, encodingModel string, pricing []estimator.Price) (*prEstimate, *api.Collector, error) {
+	if err := resolveCredentials(&opts); err != nil {
+		return nil, nil, err
+	}
+	filter, err := newPRFilter(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The App installation is looked up on the PR's owner; PR data and comments change between
+	// runs, so there is no HTTP cache
+	opts.Repos = stringList{owner + "/" + repo}
+	client, err := newClient(ctx, opts, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy := api.DefaultPolicy
+	policy.RetriesNonRate = opts.RetriesNonRate
+	collector := api.NewCollector(client, policy)
+
+	pr, err := collector.PullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, nil, fail(authOr(err, exitError), "loading pull request", "err", err)
+	}
+	est := &prEstimate{
+		Repo:          owner + "/" + repo,
+		Number:        number,
+		Title:         pr.GetTitle(),
+		Author:        pr.GetUser().GetLogin(),
+		Excluded:      filter.Match(pr),
+		EncodingModel: encodingModel,
+	}
+	if est.Excluded != "" {
+		return est, collector, nil
+	}
+	diff, err := collector.PRDiff(ctx, owner, repo, number)
+	if err != nil {
+		return nil, nil, fail(exitError, "loading pull request diff", "err", err)
+	}
+	est.DiffChars = len(diff)
+	tok, err := estimator.NewTiktoken(encodingModel)
+	if err != nil {
+		slog.Warn("tokenizer unavailable; token and cost estimates will be zero", "err", err)
+	} else if est.Tokens, err = tok.CountTokens(diff); err != nil {
+		slog.Warn("tokenizing the diff failed; token and cost estimates will be zero", "err", err)
+		est.Tokens = 0
+	}
+	for _, p := range pricing {
+		est.Costs = append(est.Costs, prCost{Name: p.Name, USDPerM: p.USDPerM, USD: float64(est.Tokens) / 1000000.0 * p.USDPerM})
+	}
+	return est, collector, nil
+}
+
+// commentAuthor returns the login comments posted with opts' credentials appear under, so that
+// --comment only ever edits the tool's own comment: the app's bot for --github-app-id, the
+// authenticated user for a token, and github-actions[bot] for the workflow GITHUB_TOKEN, which
+// cannot read /user.
+func commentAuthor(ctx context.Context, opts CLIOptions, collector *api.Collector) (string, error) {
+	if opts.AppID != 0 {
+		key, err := ghapp.LoadPrivateKey(opts.AppKeyFile)
+		if err != nil {
+			return "", err
+		}
+		return ghapp.BotLogin(ctx, ghapp.Config{AppID: opts.AppID, PrivateKey: key, BaseURL: opts.APIURL})
+	}
+	login, err := collector.Login(ctx)
+	var ghErr *github.ErrorResponse
+	if err != nil && os.Getenv("GITHUB_ACTIONS") == "true" && errors.As(err, &ghErr) && ghErr.Response.StatusCode == http.StatusForbidden {
+		return "github-actions[bot]", nil
+	}
+	return login, err
+}
+
+// printPREstimate writes the estimate in the style of the run summary.
+func printPREstimate(w io.Writer, est *prEstimate) {
+	fmt.Fprintf(w, "PR %s#%d: %s (@%s)\n", est.Repo, est.Number, est.Title, est.Author)
+	if est.Excluded != "" {
+		fmt.Fprintf(w, " - Excluded by filter %s: not counted in estimates\n", est.Excluded)
+		return
+	}
+	fmt.Fprintf(w, " - Diff chars: %d\n", est.DiffChars)
+	fmt.Fprintf(w, " - Tokens (%s): %d\n", est.EncodingModel, est.Tokens)
+	for _, c := range est.Costs {
+		fmt.Fprintf(w, " - Est. review cost (%s @ $%g/1M): $%.4f\n", c.Name, c.USDPerM, c.USD)
+	}
+}
+
+// prCommentBody renders the sticky comment, in the report's Korean with English labels.
+func prCommentBody(est *prEstimate) string {
+	var b strings.Builder
+	b.WriteString(prCommentMarker + "\n")
+	b.WriteString("### PR 에이전트 리뷰 비용 추정 (PR agent review cost estimate)\n\n")
+	if est.Excluded != "" {
+		fmt.Fprintf(&b, "이 PR은 필터 `%s`에 의해 추정에서 제외됩니다 (excluded from estimates).\n", est.Excluded)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "diff %d자 (chars), 토큰 %d개 (tokens, `%s`)\n\n", est.DiffChars, est.Tokens, est.EncodingModel)
+	b.WriteString("| 모델 (Model) | 1M 토큰당 USD (USD per 1M tokens) | 리뷰 1회 비용 (Cost per review) |\n")
+	b.WriteString("|---|---:|---:|\n")
+	for _, c := range est.Costs {
+		fmt.Fprintf(&b, "| %s | $%g | $%.4f |\n", c.Name, c.USDPerM, c.USD)
+	}
+	return b.String()
+}
@@ -0,0 +1,779 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	api "pr-agent-cost-estimator/internal/api"
+	metrics "pr-agent-cost-estimator/internal/metrics"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// Job states.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// maxQueuedJobs bounds the backlog; further submissions get 503 until the queue drains.
+const maxQueuedJobs = 100
+
+// jobRequest is the body of POST /api/jobs. Empty fields fall back to the server's flags, so
+// {} estimates the server's default --org/--repos.
+type jobRequest struct {
+	Orgs    []string `json:"orgs,omitempty"`
+	Repos   []string `json:"repos,omitempty"`
+	Since   string   `json:"since,omitempty"`
+	Until   string   `json:"until,omitempty"`
+	Fast    bool     `json:"fast,omitempty"`
+	Pricing []string `json:"pricing,omitempty"`
+}
+
+// job is one estimate run, persisted as job.json next to its dataset, analysis and report.
+type job struct {
+	ID         string      `json:"id"`
+	Status     string      `json:"status"`
+	Request    jobRequest  `json:"request"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	StartedAt  *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Summary    *jobSummary `json:"summary,omitempty"`
+}
+
+// jobSummary holds the headline numbers of a finished job so pollers need not fetch the result.
+type jobSummary struct {
+	Title               string           `json:"title"`
+	Window              string           `json:"window"`
+	TotalPRs            int              `json:"totalPRs"`
+	AvgMonthlyTokens    int64            `json:"avgMonthlyTokens"`
+	DataCompletenessPct float64          `json:"dataCompletenessPct"`
+	Costs               []estimator.Cost `json:"costs"`
+}
+
+// server runs jobs one at a time, since they share the token's rate limit, and serves their
+// stored results.
+type server struct {
+	dir           string
+	base          CLIOptions
+	encodingModel string
+	pricing       []estimator.Price
+	loc           *time.Location
+	allowOrgs     map[string]bool // lower-cased orgs jobs may estimate: --allow-org plus the default targets' owners
+	allowedHosts  map[string]bool // lower-cased Host names accepted besides loopback ones: --allowed-host and the --addr host
+
+	mu       sync.Mutex
+	jobs     map[string]*job
+	analyses map[string]*estimator.Analysis // finished jobs' results, loaded on demand for /metrics
+	queue    chan string
+
+	crawlerMu sync.Mutex
+	crawlers  map[string]*crawler // by cacheIdentity, so jobs share pacing and rate-limit state
+}
+
+// runServe implements "serve": a long-running HTTP server that estimates orgs or repositories
+// on request. Jobs use the CLI's flags and one collector per credential; every job keeps its dataset,
+// analysis and rendered report under --data-dir, so results survive restarts.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var opts CLIOptions
+	var encodingModel, addr, dataDir string
+	var prices, allowOrgs, allowedHosts stringList
+	crawlFlags(fs, &opts)
+	analysisFlags(fs, &encodingModel, &prices)
+	configFlags(fs, &opts.Config, &opts.Profile)
+	serveFlags(fs, &addr, &dataDir, &allowOrgs, &allowedHosts)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [--addr HOST:PORT] [--data-dir DIR] [--allow-org ORG ...] [--allowed-host NAME ...] [crawl and analysis flags used as job defaults]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	opts.Origins = applyConfig(fs, opts.Config, opts.Profile)
+	setupLogger(opts.LogLevel, opts.LogFormat)
+	pricing := parsePricing(prices)
+	if opts.DryRun {
+		slog.Error("--dry-run is not supported by serve")
+		os.Exit(exitUsage)
+	}
+	loc, err := time.LoadLocation(opts.Timezone)
+	if err != nil {
+		slog.Error("invalid timezone, expected an IANA name such as Asia/Seoul, UTC or Local", "value", opts.Timezone, "source", optionSource(opts, "timezone"))
+		os.Exit(exitUsage)
+	}
+	if opts.Progress == "auto" {
+		// no terminal to redraw: report crawl progress as log records
+		opts.Progress = "log"
+	}
+	if dataDir == "" {
+		d, err := os.UserCacheDir()
+		if err != nil {
+			slog.Error("no --data-dir and no user cache directory", "err", err)
+			os.Exit(exitUsage)
+		}
+		dataDir = filepath.Join(d, "pr-agent-cost-estimator", "jobs")
+	}
+	srv, err := newServer(dataDir, opts, encodingModel, pricing, loc)
+	if err != nil {
+		slog.Error("opening --data-dir", "path", dataDir, "err", err)
+		os.Exit(exitError)
+	}
+	// Without --allow-org, jobs are limited to the owners of the server's own targets
+	owners, err := defaultOwners(opts)
+	if err != nil {
+		slog.Error("reading --repos-file", "path", opts.ReposFile, "err", err)
+		os.Exit(exitUsage)
+	}
+	srv.allowOrgs = lowerSet(append(allowOrgs, owners...))
+	if len(srv.allowOrgs) == 0 {
+		slog.Error("serve needs --allow-org (or a default --org/--repos) to limit which orgs jobs may estimate")
+		os.Exit(exitUsage)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("listening", "addr", addr, "err", err)
+		os.Exit(exitError)
+	}
+	srv.allowedHosts = lowerSet(allowedHosts)
+	host, _, _ := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		if len(allowedHosts) == 0 {
+			slog.Warn("listening on all interfaces, but only loopback Host names are accepted; add --allowed-host for the names clients use")
+		}
+	} else {
+		srv.allowedHosts[strings.ToLower(host)] = true
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workerDone := make(chan struct{})
+	go func() {
+		srv.work(ctx)
+		close(workerDone)
+	}()
+	hs := &http.Server{Handler: srv.routes(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		slog.Info("shutting down; the running job is stopped and marked failed")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		hs.Shutdown(shutdownCtx)
+	}()
+	fmt.Printf("Serving on http://%s/ (data: %s)\n", ln.Addr(), dataDir)
+	if err := hs.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("serving", "err", err)
+		os.Exit(exitError)
+	}
+	<-workerDone
+}
+
+// serveFlags registers the options specific to serve.
+func serveFlags(fs *flag.FlagSet, addr, dataDir *string, allowOrgs, allowedHosts *stringList) {
+	fs.StringVar(addr, "addr", "127.0.0.1:8080", "Address to listen on")
+	fs.StringVar(dataDir, "data-dir", "", "Directory for jobs, datasets, analyses and reports (default: <user cache dir>/pr-agent-cost-estimator/jobs)")
+	fs.Var(allowOrgs, "allow-org", "Org or user jobs may estimate, including owners of requested repos (repeatable or comma separated; default: the owners of --org/--repos)")
+	fs.Var(allowedHosts, "allowed-host", "Host name clients use to reach the server, besides localhost, loopback addresses and the --addr host (repeatable or comma separated)")
+}
+
+// defaultOwners returns the owners of the server's default targets: --org and the owners of
+// --repos and --repos-file entries.
+func defaultOwners(opts CLIOptions) ([]string, error) {
+	owners := splitList(opts.Orgs)
+	repos := splitList(opts.Repos)
+	if opts.ReposFile != "" {
+		names, err := readReposFile(opts.ReposFile)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, names...)
+	}
+	for _, r := range repos {
+		if owner, _, ok := strings.Cut(r, "/"); ok && owner != "" {
+			owners = append(owners, owner)
+		}
+	}
+	return owners, nil
+}
+
+// lowerSet lower-cases logins or host names into a set, splitting comma separated entries.
+func lowerSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range splitList(values) {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
+
+// newServer loads the jobs stored in dir. Queued jobs are queued again; a job that was running
+// when the previous server stopped is marked failed.
+func newServer(dir string, base CLIOptions, encodingModel string, pricing []estimator.Price, loc *time.Location) (*server, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &server{dir: dir, base: base, encodingModel: encodingModel, pricing: pricing, loc: loc, jobs: map[string]*job{}, analyses: map[string]*estimator.Analysis{}, queue: make(chan string, maxQueuedJobs)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), "job.json"))
+		if err != nil {
+			continue
+		}
+		var j job
+		if err := json.Unmarshal(data, &j); err != nil || j.ID != e.Name() {
+			slog.Warn("skipping unreadable job", "dir", e.Name(), "err", err)
+			continue
+		}
+		s.jobs[j.ID] = &j
+	}
+	for _, j := range s.list() {
+		switch j.Status {
+		case jobRunning:
+			now := time.Now()
+			j.Status, j.Error, j.FinishedAt = jobFailed, "server stopped during the run", &now
+			if err := s.save(j); err != nil {
+				return nil, err
+			}
+		case jobQueued:
+			select {
+			case s.queue <- j.ID:
+			default:
+				slog.Warn("job queue full; leaving stored job queued", "job", j.ID)
+			}
+		}
+	}
+	return s, nil
+}
+
+// list returns the jobs oldest first.
+func (s *server) list() []*job {
+	out := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j)
+	}
+	sort.Slice(out, func(i, k int) bool {
+		if !out[i].CreatedAt.Equal(out[k].CreatedAt) {
+			return out[i].CreatedAt.Before(out[k].CreatedAt)
+		}
+		return out[i].ID < out[k].ID
+	})
+	return out
+}
+
+// crawler returns the crawler for opts' credential, creating it on first use, so jobs share
+// one collector's pacing and rate-limit state instead of each starting from scratch. ctx is the
+// worker's, which outlives every job.
+func (s *server) crawler(ctx context.Context, opts CLIOptions, policy api.Policy) (*crawler, error) {
+	s.crawlerMu.Lock()
+	defer s.crawlerMu.Unlock()
+	id := cacheIdentity(opts)
+	if cr := s.crawlers[id]; cr != nil {
+		return cr, nil
+	}
+	cr, err := newCrawler(ctx, opts, policy)
+	if err != nil {
+		return nil, err
+	}
+	if s.crawlers == nil {
+		s.crawlers = map[string]*crawler{}
+	}
+	s.crawlers[id] = cr
+	return cr, nil
+}
+
+// path returns a file of job id's directory.
+func (s *server) path(id, name string) string {
+	return filepath.Join(s.dir, id, name)
+}
+
+// save writes job.json; callers hold s.mu or own j exclusively.
+func (s *server) save(j *job) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, j.ID), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(j.ID, "job.json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(j.ID, "job.json"))
+}
+
+// update applies fn to job id under the lock and persists the result.
+func (s *server) update(id string, fn func(*job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	fn(j)
+	if err := s.save(j); err != nil {
+		slog.Error("saving job", "job", id, "err", err)
+	}
+}
+
+// snapshot returns a copy of job id that is safe to encode without the lock.
+func (s *server) snapshot(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// submit validates req and queues a new job for it.
+func (s *server) submit(req jobRequest) (job, int, error) {
+	req.Orgs, req.Repos = splitList(req.Orgs), splitList(req.Repos)
+	if len(req.Orgs) == 0 && len(req.Repos) == 0 && len(s.base.Orgs) == 0 && len(s.base.Repos) == 0 && s.base.ReposFile == "" {
+		return job{}, http.StatusBadRequest, errors.New("orgs or repos is required (the server has no default --org/--repos)")
+	}
+	owners := append([]string(nil), req.Orgs...)
+	for _, r := range req.Repos {
+		owner, name, ok := strings.Cut(r, "/")
+		if !ok || owner == "" || name == "" {
+			return job{}, http.StatusBadRequest, fmt.Errorf("invalid repository %q, expected owner/name", r)
+		}
+		owners = append(owners, owner)
+	}
+	for _, o := range owners {
+		if !s.allowOrgs[strings.ToLower(o)] {
+			return job{}, http.StatusForbidden, fmt.Errorf("org %q is not allowed on this server (--allow-org)", o)
+		}
+	}
+	now := time.Now()
+	var since, until time.Time
+	var err error
+	if req.Since != "" {
+		if since, _, err = parseBound(req.Since, s.loc, now); err != nil {
+			return job{}, http.StatusBadRequest, fmt.Errorf("since: %v", err)
+		}
+	}
+	if req.Until != "" {
+		if _, until, err = parseBound(req.Until, s.loc, now); err != nil {
+			return job{}, http.StatusBadRequest, fmt.Errorf("until: %v", err)
+		}
+		if req.Since != "" && until.Before(since) {
+			return job{}, http.StatusBadRequest, errors.New("until is before since")
+		}
+	}
+	for _, p := range splitList(req.Pricing) {
+		if _, err := estimator.ParsePrice(p); err != nil {
+			return job{}, http.StatusBadRequest, err
+		}
+	}
+
+	var b [4]byte
+	rand.Read(b[:])
+	j := &job{ID: now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b[:]), Status: jobQueued, Request: req, CreatedAt: now}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- j.ID:
+	default:
+		return job{}, http.StatusServiceUnavailable, fmt.Errorf("%d jobs already queued; try again later", maxQueuedJobs)
+	}
+	s.jobs[j.ID] = j
+	if err := s.save(j); err != nil {
+		slog.Error("saving job", "job", j.ID, "err", err)
+	}
+	slog.Info("job queued", "job", j.ID, "orgs", req.Orgs, "repos", len(req.Repos))
+	return *j, http.StatusAccepted, nil
+}
+
+// work runs queued jobs until ctx is done.
+func (s *server) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.run(ctx, id)
+		}
+	}
+}
+
+// run collects, analyzes and renders one job, storing dataset.json, analysis.json and
+// report.html in its directory; crawl output goes to output.log there.
+func (s *server) run(ctx context.Context, id string) {
+	var req jobRequest
+	s.update(id, func(j *job) {
+		now := time.Now()
+		j.Status, j.StartedAt = jobRunning, &now
+		req = j.Request
+	})
+	slog.Info("job started", "job", id)
+	summary, err := s.execute(ctx, id, req)
+	s.update(id, func(j *job) {
+		now := time.Now()
+		j.FinishedAt = &now
+		if err != nil {
+			j.Status, j.Error = jobFailed, err.Error()
+			return
+		}
+		j.Status, j.Summary = jobDone, summary
+	})
+	if err != nil {
+		slog.Warn("job failed", "job", id, "err", err)
+		return
+	}
+	slog.Info("job done", "job", id, "prs", summary.TotalPRs, "completeness_pct", summary.DataCompletenessPct)
+}
+
+func (s *server) execute(ctx context.Context, id string, req jobRequest) (*jobSummary, error) {
+	opts := s.base
+	if len(req.Orgs) > 0 || len(req.Repos) > 0 {
+		opts.Orgs, opts.Repos, opts.ReposFile = req.Orgs, req.Repos, ""
+	}
+	if req.Since != "" {
+		opts.Since = req.Since
+	}
+	if req.Until != "" {
+		opts.Until = req.Until
+	}
+	opts.Fast = opts.Fast || req.Fast
+	pricing := s.pricing
+	if len(req.Pricing) > 0 {
+		pricing = nil
+		for _, v := range splitList(req.Pricing) {
+			p, err := estimator.ParsePrice(v)
+			if err != nil {
+				return nil, err
+			}
+			pricing = append(pricing, p)
+		}
+	}
+
+	logFile, err := os.Create(s.path(id, "output.log"))
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+	ds, err := collectDatasetWith(ctx, opts, logFile, s.crawler)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, errors.New("server stopped during the run")
+	}
+	if err := ds.Save(s.path(id, "dataset.json")); err != nil {
+		return nil, err
+	}
+	a := analyzeDataset(ds, s.encodingModel, pricing, nil)
+	if err := a.Save(s.path(id, "analysis.json")); err != nil {
+		return nil, err
+	}
+	if err := renderHTMLReport(s.path(id, "report.html"), newReportData(a)); err != nil {
+		return nil, err
+	}
+	return &jobSummary{
+		Title:               a.Title,
+		Window:              a.Window,
+		TotalPRs:            a.Org.TotalPRs,
+		AvgMonthlyTokens:    a.Org.AvgMonthlyTokens,
+		DataCompletenessPct: a.Org.DataCompletenessPct,
+		Costs:               a.Costs,
+	}, nil
+}
+
+// routes wires the JSON API and the HTML pages:
+//
+//	POST /api/jobs              start a job (jobRequest body) → 202 with the job
+//	GET  /api/jobs              all jobs, newest first
+//	GET  /api/jobs/{id}         job status
+//	GET  /api/jobs/{id}/result  analysis JSON of a finished job
+//	GET  /api/jobs/{id}/report  HTML report of a finished job
+//	GET  /metrics               Prometheus metrics of the newest finished estimate per org
+//	GET  /                      job list with links to reports and a form to start a job
+//
+// Every route checks the Host header (see checkHost); the POST routes also reject cross-site
+// requests.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/jobs", sameOrigin(s.handleSubmit))
+	mux.HandleFunc("GET /api/jobs", s.handleList)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleStatus)
+	mux.HandleFunc("GET /api/jobs/{id}/result", s.handleFile("analysis.json"))
+	mux.HandleFunc("GET /api/jobs/{id}/report", s.handleFile("report.html"))
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("POST /jobs", sameOrigin(s.handleForm))
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	return s.checkHost(mux)
+}
+
+// checkHost rejects requests addressed to a Host the server does not answer to. A page whose
+// domain is rebound to 127.0.0.1 (DNS rebinding) is same-origin with itself, so Origin checks
+// pass, but its requests carry the attacker's domain in Host. Accepted are localhost, loopback
+// addresses and allowedHosts.
+func (s *server) checkHost(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.hostAllowed(r.Host) {
+			http.Error(w, "host not allowed (see --allowed-host)", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// hostAllowed reports whether a Host header value, with or without a port, names the server.
+func (s *server) hostAllowed(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return s.allowedHosts[host]
+}
+
+// sameOrigin rejects cross-site browser requests, so another page cannot start jobs through a
+// visitor's browser. Browsers send Sec-Fetch-Site or Origin on every POST; requests without
+// either come from non-browser clients such as curl and are allowed.
+func sameOrigin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch site := r.Header.Get("Sec-Fetch-Site"); {
+		case site == "same-origin" || site == "none":
+		case site != "":
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		case r.Header.Get("Origin") != "":
+			if u, err := url.Parse(r.Header.Get("Origin")); err != nil || u.Host != r.Host {
+				http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+func (s *server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid job request: %v", err))
+		return
+	}
+	j, code, err := s.submit(req)
+	if err != nil {
+		writeJSONError(w, code, err)
+		return
+	}
+	w.Header().Set("Location", "/api/jobs/"+j.ID)
+	writeJSON(w, code, j)
+}
+
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.newestFirst())
+}
+
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.snapshot(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// handleFile serves a stored artifact of a finished job; unfinished jobs get 409.
+func (s *server) handleFile(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := s.snapshot(r.PathValue("id"))
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, errors.New("no such job"))
+			return
+		}
+		if j.Status != jobDone {
+			writeJSONError(w, http.StatusConflict, fmt.Errorf("job is %s", j.Status))
+			return
+		}
+		http.ServeFile(w, r, s.path(j.ID, name))
+	}
+}
+
+// handleMetrics exports job counts and, for every org, the estimate of the newest finished job
+// covering it; run health comes from the newest job per target.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	set := metrics.NewSet()
+	jobs := s.newestFirst()
+	counts := map[string]int{}
+	for _, j := range jobs {
+		counts[j.Status]++
+	}
+	for _, st := range []string{jobQueued, jobRunning, jobDone, jobFailed} {
+		set.Gauge("pr_cost_jobs", "Jobs stored by the server, by status.", float64(counts[st]), "status", st)
+	}
+	seenOrg, seenTarget := map[string]bool{}, map[string]bool{}
+	for _, j := range jobs {
+		if j.Status != jobDone {
+			continue
+		}
+		a, err := s.analysis(j.ID)
+		if err != nil {
+			slog.Warn("loading job result for metrics", "job", j.ID, "err", err)
+			continue
+		}
+		addEstimateMetrics(set, a, func(org string) bool { return !seenOrg[org] })
+		for _, org := range analysisOrgs(a) {
+			seenOrg[org] = true
+		}
+		if !seenTarget[a.Title] {
+			seenTarget[a.Title] = true
+			addRunMetrics(set, a)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	set.WriteTo(w)
+}
+
+// analysis returns the stored result of a finished job, caching it since it never changes.
+func (s *server) analysis(id string) (*estimator.Analysis, error) {
+	s.mu.Lock()
+	a, ok := s.analyses[id]
+	s.mu.Unlock()
+	if ok {
+		return a, nil
+	}
+	a, err := estimator.LoadAnalysis(s.path(id, "analysis.json"))
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.analyses[id] = a
+	s.mu.Unlock()
+	return a, nil
+}
+
+// handleForm starts a job from the index page form.
+func (s *server) handleForm(w http.ResponseWriter, r *http.Request) {
+	req := jobRequest{
+		Orgs:  []string{r.FormValue("orgs")},
+		Repos: []string{r.FormValue("repos")},
+		Since: strings.TrimSpace(r.FormValue("since")),
+		Until: strings.TrimSpace(r.FormValue("until")),
+		Fast:  r.FormValue("fast") != "",
+	}
+	if _, code, err := s.submit(req); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, s.newestFirst()); err != nil {
+		slog.Warn("rendering index", "err", err)
+	}
+}
+
+// newestFirst returns copies of all jobs, newest first.
+func (s *server) newestFirst() []job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := s.list()
+	out := make([]job, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		out = append(out, *all[i])
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!doctype html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1" />
+  <title>PR-Agent Cost Estimator</title>
+  <style>
+    body { font-family: -apple-system, BlinkMacSystemFont, Segoe UI, Roboto, Helvetica, Arial, sans-serif; margin: 2rem; color: #222; }
+    .card { border: 1px solid #eee; border-radius: 8px; padding: 1rem; margin: 1rem 0; }
+    table { width: 100%; border-collapse: collapse; font-size: 0.95rem; }
+    th, td { text-align: left; padding: 8px; border-bottom: 1px solid #eee; }
+    th { background: #f6f6f6; }
+    input[type=text] { padding: 4px; margin-right: 0.8rem; }
+    .failed { color: #b00020; }
+  </style>
+</head>
+<body>
+  <h1>PR-Agent 비용 예측 (Cost Estimator)</h1>
+  <div class="card">
+    <h2>새 분석 (New estimate)</h2>
+    <form method="post" action="/jobs">
+      <label>Org <input type="text" name="orgs" placeholder="acme, acme-labs" /></label>
+      <label>Repos <input type="text" name="repos" placeholder="owner/name, ..." /></label>
+      <label>Since <input type="text" name="since" placeholder="2024-07-01 or 90d" /></label>
+      <label>Until <input type="text" name="until" placeholder="last-quarter" /></label>
+      <label><input type="checkbox" name="fast" /> fast</label>
+      <button type="submit">시작 (Start)</button>
+    </form>
+  </div>
+  <div class="card">
+    <h2>작업 목록 (Jobs)</h2>
+    {{if .}}
+    <table>
+      <thead><tr><th>Job</th><th>Status</th><th>Target</th><th>Window</th><th>PRs</th><th>Est. monthly cost</th><th>Report</th></tr></thead>
+      <tbody>
+      {{range .}}
+        <tr>
+          <td><a href="/api/jobs/{{.ID}}">{{.ID}}</a></td>
+          <td{{if eq .Status "failed"}} class="failed" title="{{.Error}}"{{end}}>{{.Status}}</td>
+          <td>{{if .Summary}}{{.Summary.Title}}{{else}}{{range $i, $o := .Request.Orgs}}{{if $i}}, {{end}}{{$o}}{{end}}{{if and .Request.Orgs .Request.Repos}}, {{end}}{{range $i, $r := .Request.Repos}}{{if $i}}, {{end}}{{$r}}{{end}}{{end}}</td>
+          <td>{{if .Summary}}{{.Summary.Window}}{{else}}{{.Request.Since}} – {{.Request.Until}}{{end}}</td>
+          <td>{{if .Summary}}{{.Summary.TotalPRs}}{{end}}</td>
+          <td>{{if .Summary}}{{range $i, $c := .Summary.Costs}}{{if $i}}, {{end}}{{$c.Name}} ${{printf "%.2f" $c.MonthlyUSD}}{{end}}{{end}}</td>
+          <td>{{if eq .Status "done"}}<a href="/api/jobs/{{.ID}}/report">HTML</a> · <a href="/api/jobs/{{.ID}}/result">JSON</a>{{end}}</td>
+        </tr>
+      {{end}}
+      </tbody>
+    </table>
+    {{else}}
+    <p>아직 작업이 없습니다 (No jobs yet).</p>
+    {{end}}
+  </div>
+</body>
+</html>
+`))
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fakegithub "pr-agent-cost-estimator/internal/fakegithub"
+	estimator "pr-agent-cost-estimator/pkg/estimator"
+)
+
+// testServer returns a server over an empty data dir whose worker is not started, so submitted
+// jobs stay queued. It answers to estimator.local besides the loopback names.
+func testServer(t *testing.T, allowOrgs ...string) *server {
+	t.Helper()
+	s, err := newServer(t.TempDir(), CLIOptions{}, "cl100k_base", nil, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.allowOrgs = lowerSet(allowOrgs)
+	s.allowedHosts = lowerSet([]string{"estimator.local"})
+	return s
+}
+
+// TestServeSameOrigin checks that both job-starting endpoints refuse cross-site browser requests
+// and accept same-origin and non-browser ones.
+func TestServeSameOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"no browser headers", nil, http.StatusAccepted},
+		{"same-origin fetch", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://estimator.local"}, http.StatusAccepted},
+		{"typed into the address bar", map[string]string{"Sec-Fetch-Site": "none"}, http.StatusAccepted},
+		{"same origin without fetch metadata", map[string]string{"Origin": "http://estimator.local"}, http.StatusAccepted},
+		{"cross-site fetch", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"same-site subdomain", map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "http://other.estimator.local"}, http.StatusForbidden},
+		{"other origin without fetch metadata", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"other port", map[string]string{"Origin": "http://estimator.local:8081"}, http.StatusForbidden},
+		{"opaque origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		for _, ep := range []struct{ path, contentType, body string }{
+			{"/api/jobs", "application/json", `{"orgs":["acme"]}`},
+			{"/jobs", "application/x-www-form-urlencoded", url.Values{"orgs": {"acme"}}.Encode()},
+		} {
+			s := testServer(t, "acme")
+			req := httptest.NewRequest(http.MethodPost, "http://estimator.local"+ep.path, strings.NewReader(ep.body))
+			req.Header.Set("Content-Type", ep.contentType)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.routes().ServeHTTP(rec, req)
+			want := tt.want
+			if want == http.StatusAccepted && ep.path == "/jobs" {
+				want = http.StatusSeeOther // the form redirects back to the job list
+			}
+			if rec.Code != want {
+				t.Errorf("%s, POST %s: status = %d, want %d (%s)", tt.name, ep.path, rec.Code, want, rec.Body)
+			}
+			if queued := len(s.jobs); (want == http.StatusForbidden) != (queued == 0) {
+				t.Errorf("%s, POST %s: %d jobs queued", tt.name, ep.path, queued)
+			}
+		}
+	}
+}
+
+// TestServeAllowOrg checks that --allow-org limits both requested orgs and repository owners,
+// case-insensitively, and that the server's own defaults are not subject to it.
+func TestServeAllowOrg(t *testing.T) {
+	tests := []struct {
+		name string
+		req  jobRequest
+		want int
+	}{
+		{"allowed org", jobRequest{Orgs: []string{"acme"}}, http.StatusAccepted},
+		{"allowed org, other case", jobRequest{Orgs: []string{"Acme-Labs"}}, http.StatusAccepted},
+		{"comma separated", jobRequest{Orgs: []string{"acme, acme-labs"}}, http.StatusAccepted},
+		{"allowed repo owner", jobRequest{Repos: []string{"ACME/api"}}, http.StatusAccepted},
+		{"other org", jobRequest{Orgs: []string{"acme", "rival"}}, http.StatusForbidden},
+		{"other repo owner", jobRequest{Orgs: []string{"acme"}, Repos: []string{"rival/secret"}}, http.StatusForbidden},
+		{"server defaults", jobRequest{}, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		s := testServer(t, "acme", "ACME-labs")
+		s.base.Orgs = stringList{"acme"}
+		_, code, err := s.submit(tt.req)
+		if code != tt.want {
+			t.Errorf("%s: status = %d (%v), want %d", tt.name, code, err, tt.want)
+		}
+		if code == http.StatusForbidden && (err == nil || !strings.Contains(err.Error(), "--allow-org")) {
+			t.Errorf("%s: err = %v, want it to name --allow-org", tt.name, err)
+		}
+	}
+
+	// An empty allowlist refuses every org
+	if _, code, err := testServer(t).submit(jobRequest{Orgs: []string{"acme"}}); code != http.StatusForbidden {
+		t.Errorf("no allowlist: status = %d (%v), want 403", code, err)
+	}
+}
+
+// TestServeDefaultOwners checks that without --allow-org the owners of the server's own targets
+// are the allowlist.
+func TestServeDefaultOwners(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "repos.txt")
+	if err := os.WriteFile(file, []byte("# listed\nfile-owner/app\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	owners, err := defaultOwners(CLIOptions{Orgs: stringList{"acme,beta"}, Repos: stringList{"gamma/api"}, ReposFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(owners, ","), "acme,beta,gamma,file-owner"; got != want {
+		t.Errorf("owners = %s, want %s", got, want)
+	}
+	if owners, err := defaultOwners(CLIOptions{}); err != nil || len(owners) != 0 {
+		t.Errorf("no targets: owners = %v, %v, want none: serve refuses to start", owners, err)
+	}
+}
+
+// TestServeHost checks that every route, not only job submission, refuses requests addressed to
+// a Host other than loopback names and --allowed-host, as a DNS-rebound page would send.
+func TestServeHost(t *testing.T) {
+	s := testServer(t, "acme")
+	j, _, err := s.submit(jobRequest{Orgs: []string{"acme"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost:8080", true},
+		{"LOCALHOST.", true},
+		{"127.0.0.1:8080", true},
+		{"127.0.0.2", true},
+		{"[::1]:8080", true},
+		{"estimator.local", true},
+		{"Estimator.Local:8443", true},
+		{"evil.example:8080", false},
+		{"127.0.0.1.nip.io:8080", false},
+		{"localhost.evil.example", false},
+		{"10.0.0.5:8080", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		for _, route := range []struct{ method, path string }{
+			{http.MethodGet, "/"},
+			{http.MethodGet, "/api/jobs"},
+			{http.MethodGet, "/api/jobs/" + j.ID},
+			{http.MethodGet, "/api/jobs/" + j.ID + "/report"},
+			{http.MethodGet, "/metrics"},
+			{http.MethodPost, "/api/jobs"},
+		} {
+			req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{"orgs":["acme"]}`))
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			s.routes().ServeHTTP(rec, req)
+			if rejected := rec.Code == http.StatusForbidden && strings.Contains(rec.Body.String(), "host not allowed"); rejected == tt.want {
+				t.Errorf("Host %q, %s %s: status = %d, want allowed=%v", tt.host, route.method, route.path, rec.Code, tt.want)
+			}
+		}
+	}
+}
+
+func TestConfigKeysIncludeServe(t *testing.T) {
+	keys := configKeys()
+	for _, k := range []string{"addr", "data-dir", "allow-org", "allowed-host"} {
+		if !keys[k] {
+			t.Errorf("config key %q is not accepted", k)
+		}
+	}
+}
+
+// TestServeSharedCollector runs two jobs against fakegithub: both crawl with the server's one
+// collector for the credential, and each dataset counts only its own job's API calls.
+func TestServeSharedCollector(t *testing.T) {
+	srv := fakegithub.New(pipelineOrg())
+	defer srv.Close()
+	s, err := newServer(t.TempDir(), pipelineOptions(t, srv.URL+"/"), "test", testPricing, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int64
+	for _, id := range []string{"first", "second"} {
+		if err := os.MkdirAll(filepath.Join(s.dir, id), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.execute(context.Background(), id, jobRequest{}); err != nil {
+			t.Fatalf("job %s: %v", id, err)
+		}
+		ds, err := estimator.LoadDataset(s.path(id, "dataset.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ds.Crawl == nil || ds.Crawl.APICalls == 0 {
+			t.Fatalf("job %s crawl stats = %+v", id, ds.Crawl)
+		}
+		calls += ds.Crawl.APICalls
+	}
+	if len(s.crawlers) != 1 {
+		t.Fatalf("crawlers = %d, want one for the shared token", len(s.crawlers))
+	}
+	for _, cr := range s.crawlers {
+		if got := cr.collector.Snapshot().APICalls; got != calls {
+			t.Errorf("collector made %d calls, want the jobs' %d together", got, calls)
+		}
+	}
+}
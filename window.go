@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeAge matches bounds such as "90d" or "12w": that many days or weeks before today.
+var relativeAge = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// windowForms lists the accepted --since/--until forms for error messages.
+const windowForms = "YYYY-MM-DD, an RFC3339 time, an age such as 90d or 12w, today, yesterday, or this-/last- week, month, quarter or year"
+
+// parseBound returns the first and last instant, in loc, of the day or period s names; for an
+// RFC3339 time both are that instant. --since uses the first and --until the last, so a date
+// given to --until includes that whole day. Weeks start on Monday.
+func parseBound(s string, loc *time.Location, now time.Time) (time.Time, time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, t, nil
+	}
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	if g := relativeAge.FindStringSubmatch(s); g != nil {
+		n, err := strconv.Atoi(g[1])
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%q: %v", s, err)
+		}
+		if g[2] == "w" {
+			n *= 7
+		}
+		day := today.AddDate(0, 0, -n)
+		return day, day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+
+	var start time.Time
+	var months, days int
+	name := strings.ToLower(s)
+	switch name {
+	case "today":
+		start, days = today, 1
+	case "yesterday":
+		start, days = today.AddDate(0, 0, -1), 1
+	default:
+		which, unit, ok := strings.Cut(name, "-")
+		if !ok || (which != "this" && which != "last") {
+			return time.Time{}, time.Time{}, fmt.Errorf("%q: want %s", s, windowForms)
+		}
+		switch unit {
+		case "week":
+			start, days = today.AddDate(0, 0, -(int(today.Weekday())+6)%7), 7
+		case "month":
+			start, months = time.Date(y, m, 1, 0, 0, 0, 0, loc), 1
+		case "quarter":
+			start, months = time.Date(y, (m-1)/3*3+1, 1, 0, 0, 0, 0, loc), 3
+		case "year":
+			start, months = time.Date(y, time.January, 1, 0, 0, 0, 0, loc), 12
+		default:
+			return time.Time{}, time.Time{}, fmt.Errorf("%q: want %s", s, windowForms)
+		}
+		if which == "last" {
+			start = start.AddDate(0, -months, -days)
+		}
+	}
+	return start, start.AddDate(0, months, days).Add(-time.Nanosecond), nil
+}
+
+// describeWindow formats the window for reports: whole days print as dates, other bounds as
+// RFC3339, and a non-UTC zone is named.
+func describeWindow(since, until *time.Time, loc *time.Location) string {
+	if since == nil && until == nil {
+		return "all time"
+	}
+	from, to := "beginning", "now"
+	if since != nil {
+		from = since.In(loc).Format(time.RFC3339)
+		if t := since.In(loc); t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)) {
+			from = t.Format("2006-01-02")
+		}
+	}
+	if until != nil {
+		to = until.In(loc).Format(time.RFC3339)
+		if t := until.Add(time.Nanosecond).In(loc); t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)) {
+			to = until.In(loc).Format("2006-01-02")
+		}
+	}
+	window := from + " to " + to
+	if loc != time.UTC {
+		window += " (" + loc.String() + ")"
+	}
+	return window
+}